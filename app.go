@@ -0,0 +1,370 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Component 由 App 管理的组件, Run 非阻塞, 返回 nil 表示启动成功, 例如 HTTPServer, TaskServer, Scheduler
+type Component interface {
+	Run(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+var _ Component = &AppFunc{}
+
+// AppFunc 用函数构造组件, 例如数据库连接池只需要 ShutdownFunc 回收资源
+type AppFunc struct {
+	RunFunc      func(ctx context.Context) error
+	ShutdownFunc func(ctx context.Context) error
+}
+
+func (f *AppFunc) Run(ctx context.Context) error {
+	if f.RunFunc == nil {
+		return nil
+	}
+	return f.RunFunc(ctx)
+}
+
+func (f *AppFunc) Shutdown(ctx context.Context) error {
+	if f.ShutdownFunc == nil {
+		return nil
+	}
+	return f.ShutdownFunc(ctx)
+}
+
+type AppComponentConf struct {
+	Name            string                          // 组件名, 必填且唯一
+	DependsOn       []string                        // 依赖的组件, 依赖就绪后才启动, 关闭时先于依赖关闭
+	Ready           func(ctx context.Context) error // 就绪检查, Run 之后轮询直到返回 nil, 为空时 Run 返回即就绪
+	ReadyTimeout    time.Duration                   // 就绪超时, 默认 AppConf.ReadyTimeout
+	ShutdownTimeout time.Duration                   // 关闭超时, 默认 AppConf.ShutdownTimeout
+}
+
+type AppConf struct {
+	ReadyTimeout    time.Duration // 默认 30s
+	ReadyInterval   time.Duration // 就绪检查间隔, 默认 100ms
+	ShutdownTimeout time.Duration // 每个组件的关闭超时, 默认 15s
+	Signals         []os.Signal   // 退出信号, 默认 SIGQUIT SIGTERM SIGINT
+}
+
+func (c *AppConf) Validate() error {
+	if c.ReadyTimeout <= 0 {
+		c.ReadyTimeout = 30 * time.Second
+	}
+	if c.ReadyInterval <= 0 {
+		c.ReadyInterval = 100 * time.Millisecond
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 15 * time.Second
+	}
+	if len(c.Signals) == 0 {
+		c.Signals = []os.Signal{syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT}
+	}
+	return nil
+}
+
+type appComponent struct {
+	c       Component
+	cfg     AppComponentConf
+	level   int
+	ready   chan struct{}
+	started bool
+}
+
+// App 管理多个组件的生命周期
+// 按依赖并发启动, 任一组件启动失败, 收到退出信号, ctx 结束或 Fail 时, 按依赖逆序分级关闭已启动的组件
+type App struct {
+	cfg *AppConf
+
+	mutex      sync.Mutex
+	components []*appComponent
+	names      map[string]*appComponent
+	ready      chan struct{}
+	failC      chan error
+}
+
+func NewApp(cfg ...*AppConf) *App {
+	conf := &AppConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &App{
+		cfg:   conf,
+		names: make(map[string]*appComponent),
+		ready: make(chan struct{}),
+		failC: make(chan error, 1),
+	}
+}
+
+// Add 注册组件, 需在 Run 之前调用
+func (a *App) Add(c Component, cfg AppComponentConf) error {
+	if c == nil {
+		return fmt.Errorf("component required")
+	}
+	if cfg.Name == "" {
+		return fmt.Errorf("component name required")
+	}
+	if cfg.ReadyTimeout <= 0 {
+		cfg.ReadyTimeout = a.cfg.ReadyTimeout
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = a.cfg.ShutdownTimeout
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, ok := a.names[cfg.Name]; ok {
+		return fmt.Errorf("component %s exists", cfg.Name)
+	}
+	v := &appComponent{c: c, cfg: cfg, ready: make(chan struct{})}
+	a.components = append(a.components, v)
+	a.names[cfg.Name] = v
+	return nil
+}
+
+// Ready 所有组件就绪后关闭
+func (a *App) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// Fail 运行期间的致命错误, 触发关闭, 只记录第一个
+func (a *App) Fail(err error) {
+	if err == nil {
+		return
+	}
+	select {
+	case a.failC <- err:
+	default:
+	}
+}
+
+// Run 启动所有组件并阻塞, 直到关闭完成, 返回启动, 运行与关闭的所有错误
+func (a *App) Run(ctx context.Context) error {
+	if err := a.resolve(); err != nil {
+		return err
+	}
+
+	// 组件的 ctx 在全部关闭后才取消, 避免组件在依赖它的组件关闭前退出
+	runCtx, runCancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer runCancel()
+	startCtx, startCancel := context.WithCancel(ctx)
+	defer startCancel()
+
+	exitSignal := make(chan os.Signal, 1)
+	signal.Notify(exitSignal, a.cfg.Signals...)
+	defer signal.Stop(exitSignal)
+
+	errC := make(chan error, len(a.components))
+	wg := &sync.WaitGroup{}
+	for _, v := range a.components {
+		wg.Add(1)
+		go func(v *appComponent) {
+			defer wg.Done()
+			if err := a.start(runCtx, startCtx, v); err != nil {
+				errC <- err
+				startCancel()
+			}
+		}(v)
+	}
+	allStarted := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allStarted)
+	}()
+
+	errs := make([]error, 0)
+	select {
+	case <-allStarted:
+	case sig := <-exitSignal:
+		log.Printf("receive exit signal %s while starting\n", sig)
+	case <-ctx.Done():
+	case err := <-a.failC:
+		errs = append(errs, err)
+	}
+	startCancel()
+	<-allStarted
+	close(errC)
+	for err := range errC {
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 && ctx.Err() == nil && a.allStarted() {
+		close(a.ready)
+		log.Printf("app started %d components\n", len(a.components))
+		select {
+		case sig := <-exitSignal:
+			log.Printf("receive exit signal %s\n", sig)
+		case <-ctx.Done():
+		case err := <-a.failC:
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, a.shutdown()...)
+	return ErrMulti(errs...)
+}
+
+func (a *App) allStarted() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, v := range a.components {
+		if !v.started {
+			return false
+		}
+	}
+	return true
+}
+
+// start 等待依赖就绪后启动组件, startCtx 取消时放弃启动
+func (a *App) start(runCtx, startCtx context.Context, v *appComponent) error {
+	for _, dep := range v.cfg.DependsOn {
+		select {
+		case <-a.names[dep].ready:
+		case <-startCtx.Done():
+			return nil
+		}
+	}
+	if startCtx.Err() != nil {
+		return nil
+	}
+	if err := v.c.Run(runCtx); err != nil {
+		return fmt.Errorf("%s run: %w", v.cfg.Name, err)
+	}
+	a.mutex.Lock()
+	v.started = true
+	a.mutex.Unlock()
+
+	if v.cfg.Ready != nil {
+		if err := a.waitReady(startCtx, v); err != nil {
+			if startCtx.Err() != nil {
+				// 放弃启动, 不标记就绪, 依赖它的组件同样放弃
+				return nil
+			}
+			return err
+		}
+	}
+	log.Printf("app component %s ready\n", v.cfg.Name)
+	close(v.ready)
+	return nil
+}
+
+func (a *App) waitReady(ctx context.Context, v *appComponent) error {
+	ctx, cancel := context.WithTimeout(ctx, v.cfg.ReadyTimeout)
+	defer cancel()
+	for {
+		err := v.cfg.Ready(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				return fmt.Errorf("%s not ready: %w", v.cfg.Name, ctx.Err())
+			}
+			return fmt.Errorf("%s not ready: %w", v.cfg.Name, err)
+		case <-time.After(a.cfg.ReadyInterval):
+		}
+	}
+}
+
+// resolve 检查依赖并计算层级, 层级为最长依赖链的长度
+func (a *App) resolve() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(a.components))
+	var visit func(v *appComponent, path []string) error
+	visit = func(v *appComponent, path []string) error {
+		switch state[v.cfg.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("component dependency cycle %v", append(path, v.cfg.Name))
+		}
+		state[v.cfg.Name] = visiting
+		v.level = 0
+		for _, name := range v.cfg.DependsOn {
+			dep, ok := a.names[name]
+			if !ok {
+				return fmt.Errorf("component %s depends on unknown %s", v.cfg.Name, name)
+			}
+			if err := visit(dep, append(path, v.cfg.Name)); err != nil {
+				return err
+			}
+			if dep.level+1 > v.level {
+				v.level = dep.level + 1
+			}
+		}
+		state[v.cfg.Name] = visited
+		return nil
+	}
+	for _, v := range a.components {
+		if err := visit(v, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdown 从最高层级开始逐级关闭, 同一层级并发关闭, 每个组件独立超时
+func (a *App) shutdown() []error {
+	a.mutex.Lock()
+	levels := make(map[int][]*appComponent)
+	for _, v := range a.components {
+		if v.started {
+			levels[v.level] = append(levels[v.level], v)
+		}
+	}
+	a.mutex.Unlock()
+	order := make([]int, 0, len(levels))
+	for level := range levels {
+		order = append(order, level)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(order)))
+
+	errs := make([]error, 0)
+	for _, level := range order {
+		stage := levels[level]
+		stageErrs := make([]error, len(stage))
+		wg := &sync.WaitGroup{}
+		for i, v := range stage {
+			wg.Add(1)
+			go func(i int, v *appComponent) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), v.cfg.ShutdownTimeout)
+				defer cancel()
+				if err := a.shutdownComponent(ctx, v); err != nil {
+					stageErrs[i] = fmt.Errorf("%s shutdown: %w", v.cfg.Name, err)
+				}
+			}(i, v)
+		}
+		wg.Wait()
+		errs = append(errs, stageErrs...)
+	}
+	return errs
+}
+
+// shutdownComponent 组件不响应 ctx 时按超时返回
+func (a *App) shutdownComponent(ctx context.Context, v *appComponent) error {
+	errC := make(chan error, 1)
+	go func() {
+		errC <- v.c.Shutdown(ctx)
+	}()
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
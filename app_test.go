@@ -0,0 +1,168 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testAppRecorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *testAppRecorder) add(event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *testAppRecorder) index(event string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, v := range r.events {
+		if v == event {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *testAppRecorder) component(name string, runErr error) *AppFunc {
+	return &AppFunc{
+		RunFunc: func(ctx context.Context) error {
+			r.add("run " + name)
+			return runErr
+		},
+		ShutdownFunc: func(ctx context.Context) error {
+			r.add("shutdown " + name)
+			return nil
+		},
+	}
+}
+
+func TestAppOrder(t *testing.T) {
+	r := &testAppRecorder{}
+	app := NewApp()
+	ready := false
+	_ = app.Add(r.component("db", nil), AppComponentConf{Name: "db", Ready: func(ctx context.Context) error {
+		if !ready {
+			ready = true
+			return fmt.Errorf("not yet")
+		}
+		return nil
+	}})
+	_ = app.Add(r.component("cache", nil), AppComponentConf{Name: "cache"})
+	_ = app.Add(r.component("task", nil), AppComponentConf{Name: "task", DependsOn: []string{"db"}})
+	_ = app.Add(r.component("http", nil), AppComponentConf{Name: "http", DependsOn: []string{"task", "cache"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-app.Ready()
+		cancel()
+	}()
+	if err := app.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	before := func(a, b string) {
+		if i, j := r.index(a), r.index(b); i < 0 || j < 0 || i > j {
+			t.Fatalf("expect %s before %s, events %v", a, b, r.events)
+		}
+	}
+	before("run db", "run task")
+	before("run task", "run http")
+	before("run cache", "run http")
+	before("shutdown http", "shutdown task")
+	before("shutdown http", "shutdown cache")
+	before("shutdown task", "shutdown db")
+}
+
+func TestAppStartFailure(t *testing.T) {
+	r := &testAppRecorder{}
+	app := NewApp(&AppConf{ShutdownTimeout: 50 * time.Millisecond})
+	_ = app.Add(r.component("db", nil), AppComponentConf{Name: "db"})
+	_ = app.Add(r.component("broken", fmt.Errorf("listen failed")), AppComponentConf{Name: "broken", DependsOn: []string{"db", "stuck"}})
+	_ = app.Add(r.component("http", nil), AppComponentConf{Name: "http", DependsOn: []string{"broken"}})
+	_ = app.Add(&AppFunc{ShutdownFunc: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}, AppComponentConf{Name: "stuck"})
+
+	err := app.Run(context.Background())
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	if !strings.Contains(err.Error(), "broken run: listen failed") || !strings.Contains(err.Error(), "stuck shutdown: context deadline exceeded") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.index("run http") >= 0 || r.index("shutdown broken") >= 0 || r.index("shutdown http") >= 0 {
+		t.Fatalf("unexpected events %v", r.events)
+	}
+	if r.index("shutdown db") < 0 {
+		t.Fatalf("started component not shutdown %v", r.events)
+	}
+}
+
+func TestAppCancelBeforeReady(t *testing.T) {
+	r := &testAppRecorder{}
+	app := NewApp(&AppConf{ReadyInterval: 10 * time.Millisecond})
+	_ = app.Add(r.component("db", nil), AppComponentConf{Name: "db", Ready: func(ctx context.Context) error {
+		return fmt.Errorf("not yet")
+	}})
+	_ = app.Add(r.component("task", nil), AppComponentConf{Name: "task", DependsOn: []string{"db"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := app.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-app.names["db"].ready:
+		t.Fatal("db should not ready")
+	default:
+	}
+	if r.index("run task") >= 0 {
+		t.Fatalf("dependent should not start %v", r.events)
+	}
+	if r.index("shutdown db") < 0 {
+		t.Fatalf("started component not shutdown %v", r.events)
+	}
+}
+
+func TestAppFail(t *testing.T) {
+	r := &testAppRecorder{}
+	app := NewApp()
+	_ = app.Add(r.component("http", nil), AppComponentConf{Name: "http"})
+	go func() {
+		<-app.Ready()
+		app.Fail(fmt.Errorf("fatal"))
+	}()
+	if err := app.Run(context.Background()); err == nil || err.Error() != "fatal" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.index("shutdown http") < 0 {
+		t.Fatalf("not shutdown %v", r.events)
+	}
+}
+
+func TestAppResolve(t *testing.T) {
+	app := NewApp()
+	_ = app.Add(&AppFunc{}, AppComponentConf{Name: "a", DependsOn: []string{"b"}})
+	_ = app.Add(&AppFunc{}, AppComponentConf{Name: "b", DependsOn: []string{"a"}})
+	if err := app.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expect cycle error, got %v", err)
+	}
+	if err := app.Add(&AppFunc{}, AppComponentConf{Name: "a"}); err == nil {
+		t.Fatal("expect duplicate error")
+	}
+
+	app = NewApp()
+	_ = app.Add(&AppFunc{}, AppComponentConf{Name: "a", DependsOn: []string{"none"}})
+	if err := app.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("expect unknown error, got %v", err)
+	}
+}
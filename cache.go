@@ -29,6 +29,9 @@ func IsNotFoundErr(err error) bool {
 	if err == ErrCacheNotFound || err.Error() == "redis: nil" {
 		return true
 	}
+	if e, ok := err.(Err); ok && e.Code == ErrCodeNotFound {
+		return true
+	}
 	return false
 }
 
@@ -44,8 +47,6 @@ type Cacher interface {
 	Close() error
 }
 
-// redis.Client Cacher implement
-
 type CacheStore interface {
 	Get(key string) (interface{}, error)
 	Set(key string, value interface{}) error
@@ -113,6 +114,11 @@ type LRUCache struct {
 	eleIndex   map[string]*list.Element
 	store      CacheStore
 	MaxElement int
+
+	bytes   int64
+	counter cacheCounter
+	onEvict func(key string, value interface{}, reason EvictReason)
+	evicted []cacheEvicted
 }
 
 // NewLRUMemory memory store
@@ -148,7 +154,7 @@ func (m *LRUCache) runGC() {
 // GC if storage not enough, del little visit
 func (m *LRUCache) GC() {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	defer m.unlock()
 	_ = m.delAllExpiredKey()
 
 	if m.eleList.Len() < m.MaxElement {
@@ -163,10 +169,55 @@ func (m *LRUCache) GC() {
 	}
 }
 
+// OnEvict 设置淘汰回调, 超出容量淘汰和过期删除时调用, 主动 Del 不调用
+func (m *LRUCache) OnEvict(fn func(key string, value interface{}, reason EvictReason)) {
+	m.mutex.Lock()
+	m.onEvict = fn
+	m.mutex.Unlock()
+}
+
+// Stats 缓存统计, Bytes 按 cacheEntrySize 估算
+func (m *LRUCache) Stats() CacheStats {
+	s := m.counter.stats()
+	m.mutex.Lock()
+	s.Entries = int64(m.eleList.Len())
+	s.Bytes = m.bytes
+	m.mutex.Unlock()
+	return s
+}
+
+// unlock 释放锁后, 回调淘汰的条目
+func (m *LRUCache) unlock() {
+	evicted, fn := m.evicted, m.onEvict
+	m.evicted = nil
+	m.mutex.Unlock()
+	if fn == nil {
+		return
+	}
+	for _, v := range evicted {
+		fn(v.key, v.value, v.reason)
+	}
+}
+
+// goroutine not safety
+func (m *LRUCache) evict(ele *list.Element, reason EvictReason) {
+	n := ele.Value.(*cacheNode)
+	m.eleList.Remove(ele)
+	delete(m.eleIndex, n.key)
+	m.bytes -= n.size
+	m.counter.evict(reason)
+	if m.onEvict != nil {
+		v, _ := m.store.Get(n.key)
+		m.evicted = append(m.evicted, cacheEvicted{key: n.key, value: v, reason: reason})
+	}
+	_ = m.store.Del(n.key)
+}
+
 func (m *LRUCache) Get(key string) (interface{}, error) {
 	m.mutex.Lock()
 	v, err := m.get(key, false)
-	m.mutex.Unlock()
+	m.unlock()
+	m.counter.hit(err == nil)
 	return v, err
 }
 
@@ -176,9 +227,7 @@ func (m *LRUCache) get(key string, isRange bool) (interface{}, error) {
 		n := ele.Value.(*cacheNode)
 		if n.Expired(time.Now().Unix()) {
 			// expired
-			m.eleList.Remove(ele)
-			delete(m.eleIndex, key)
-			_ = m.store.Del(key)
+			m.evict(ele, EvictReasonExpired)
 			return nil, ErrNotFound
 		}
 		// if visit, move to end, not GC
@@ -197,11 +246,15 @@ func (m *LRUCache) Set(key string, val interface{}) error {
 }
 
 func (m *LRUCache) SetWithTTL(key string, val interface{}, ttl time.Duration) error {
+	size := cacheEntrySize(key, val)
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	defer m.unlock()
 	if ele, ok := m.eleIndex[key]; !ok {
-		e := m.eleList.PushBack(newCacheNode(key, ttl))
+		n := newCacheNode(key, ttl)
+		n.size = size
+		e := m.eleList.PushBack(n)
 		m.eleIndex[key] = e
+		m.bytes += size
 	} else {
 		expired := int64(-1)
 		if ttl > 0 {
@@ -210,6 +263,8 @@ func (m *LRUCache) SetWithTTL(key string, val interface{}, ttl time.Duration) er
 		n := ele.Value.(*cacheNode)
 		n.expired = expired
 		n.lastVisit = time.Now()
+		m.bytes += size - n.size
+		n.size = size
 	}
 	_ = m.store.Set(key, val)
 
@@ -225,7 +280,7 @@ func (m *LRUCache) SetWithTTL(key string, val interface{}, ttl time.Duration) er
 
 func (m *LRUCache) Range(fn func(key string, value interface{}) bool) {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	defer m.unlock()
 
 	for k := range m.eleIndex {
 		v, err := m.get(k, true)
@@ -243,14 +298,13 @@ func (m *LRUCache) delAllExpiredKey() int {
 	delCount := 0
 	now := time.Now().Unix()
 	for ele := m.eleList.Front(); ele != nil; {
-		n := ele.Value.(*cacheNode)
-		if n.Expired(now) {
-			m.eleList.Remove(ele)
-			delete(m.eleIndex, n.key)
-			_ = m.store.Del(n.key)
+		// Remove 之后 ele.Next() 为 nil, 先取下一个
+		next := ele.Next()
+		if ele.Value.(*cacheNode).Expired(now) {
+			m.evict(ele, EvictReasonExpired)
 			delCount++
 		}
-		ele = ele.Next()
+		ele = next
 	}
 	return delCount
 }
@@ -260,10 +314,7 @@ func (m *LRUCache) delFrontKey() bool {
 	if ele == nil {
 		return false
 	}
-	n := ele.Value.(*cacheNode)
-	m.eleList.Remove(ele)
-	delete(m.eleIndex, n.key)
-	_ = m.store.Del(n.key)
+	m.evict(ele, EvictReasonCapacity)
 	return true
 }
 
@@ -274,6 +325,7 @@ func (m *LRUCache) Del(key string) error {
 	if ele, ok := m.eleIndex[key]; ok {
 		m.eleList.Remove(ele)
 		delete(m.eleIndex, key)
+		m.bytes -= ele.Value.(*cacheNode).size
 	}
 	return m.store.Del(key)
 }
@@ -286,6 +338,7 @@ type cacheNode struct {
 	key       string
 	expired   int64
 	lastVisit time.Time
+	size      int64
 }
 
 func (n *cacheNode) Expired(now int64) bool {
@@ -318,6 +371,11 @@ type LimitMemoryCache struct {
 
 	// cache value, save write file
 	filename string
+	// 增量持久化, NewLimitMemoryCacheWithPersist 开启
+	persist *cachePersister
+
+	counter cacheCounter
+	onEvict func(key string, value interface{}, reason EvictReason)
 }
 
 // NewMemCache
@@ -372,21 +430,45 @@ func (val *IValue) Expired(now int64) bool {
 	return val.ExpiredTime.Unix() < now
 }
 
+// OnEvict 设置淘汰回调, 过期删除时调用, 主动 Del 不调用
+// LimitMemoryCache 超出容量时 Set 返回 ErrCacheSizeOverCapacity, 不会淘汰
+func (m *LimitMemoryCache) OnEvict(fn func(key string, value interface{}, reason EvictReason)) {
+	m.rwMutex.Lock()
+	m.onEvict = fn
+	m.rwMutex.Unlock()
+}
+
+// Stats 缓存统计, Bytes 限制了 size 时与容量判断一致, 否则按 cacheEntrySize 估算
+func (m *LimitMemoryCache) Stats() CacheStats {
+	s := m.counter.stats()
+	m.rwMutex.RLock()
+	s.Entries = int64(len(m.store))
+	m.rwMutex.RUnlock()
+	s.Bytes = int64(atomic.LoadInt32(&m.currentSize))
+	return s
+}
+
 func (m *LimitMemoryCache) Get(key string) (interface{}, error) {
 	m.rwMutex.RLock()
 	v, err := m.get(key)
 	m.rwMutex.RUnlock()
+	if err == errCacheExpired {
+		// if expired, just del
+		_, _ = m.delete(key, true)
+		err = ErrNotFound
+	}
+	m.counter.hit(err == nil)
 	return v, err
 }
 
+var errCacheExpired = errors.New("bkit/caches: expired")
+
 // goroutine not safety
 func (m *LimitMemoryCache) get(key string) (interface{}, error) {
 	iVal, ok := m.store[key]
 	if ok {
-		// if expired, just del
 		if iVal.Expired(time.Now().Unix()) {
-			m.delete(key, true)
-			return nil, ErrNotFound
+			return nil, errCacheExpired
 		}
 		return iVal.Value, nil
 	}
@@ -412,9 +494,7 @@ func (m *LimitMemoryCache) SetWithTTL(key string, value interface{}, ttl time.Du
 	val := IValue{
 		Value: value,
 	}
-	if m.size > 0 {
-		val.Size = int32(len(key) + len(fmt.Sprint(value)))
-	}
+	val.Size = m.entrySize(key, value)
 	val.SetExpiredTime(ttl)
 
 	if err := m.set(key, val); err != nil {
@@ -429,56 +509,102 @@ func (m *LimitMemoryCache) Set(key string, value interface{}) error {
 }
 
 func (m *LimitMemoryCache) set(key string, val IValue) error {
+	var evicted []cacheEvicted
 	m.rwMutex.Lock()
+	defer func() {
+		fn := m.onEvict
+		m.rwMutex.Unlock()
+		m.callOnEvict(fn, evicted)
+	}()
 	addSize := int32(0)
 	oldVal, ok := m.store[key]
 	if !ok {
-		if err := m.isOverSize(val.Size); err != nil {
-			return err
-		}
 		addSize = val.Size
 	} else {
 		// calc storage size
-		subSize := val.Size - oldVal.Size
-		if err := m.isOverSize(subSize); err != nil {
+		addSize = val.Size - oldVal.Size
+	}
+	if m.isOverSize(addSize) {
+		// scan expired del, just del
+		evicted = m.delExpiredKey()
+		if m.isOverSize(addSize) {
+			return ErrCacheSizeOverCapacity
+		}
+		// 可能删除了自己
+		if oldVal, ok = m.store[key]; ok {
+			addSize = val.Size - oldVal.Size
+		} else {
+			addSize = val.Size
+		}
+	}
+	if m.persist != nil {
+		if err := m.persist.appendSet(key, val); err != nil {
 			return err
 		}
-		addSize = subSize
 	}
 	m.store[key] = val
 
 	atomic.AddInt32(&m.currentSize, addSize)
 
-	m.rwMutex.Unlock()
-
 	return nil
 }
 
 func (m *LimitMemoryCache) Del(key string) error {
-	m.delete(key, false)
-	return nil
+	_, err := m.delete(key, false)
+	return err
 }
 
 // return  data size
-func (m *LimitMemoryCache) delete(key string, isExpired bool) int32 {
-	var size int32
+func (m *LimitMemoryCache) delete(key string, isExpired bool) (int32, error) {
+	var (
+		size    int32
+		evicted []cacheEvicted
+		err     error
+	)
 	m.rwMutex.Lock()
 	val, ok := m.store[key]
 	if ok {
 		if (isExpired && val.Expired(time.Now().Unix())) || !isExpired {
 			// if is expired del action, verify expired time
 			// if not expired del action, just del
+			// expired key not need persist, load will skip it
+			if !isExpired && m.persist != nil {
+				err = m.persist.appendDel(key)
+			}
 			delete(m.store, key)
 			atomic.AddInt32(&m.currentSize, -val.Size)
 			size = val.Size
+			if isExpired {
+				m.counter.evict(EvictReasonExpired)
+				evicted = append(evicted, cacheEvicted{key: key, value: val.Value, reason: EvictReasonExpired})
+			}
 		}
 	}
+	fn := m.onEvict
 	m.rwMutex.Unlock()
-	return size
+	m.callOnEvict(fn, evicted)
+	return size, err
+}
+
+func (m *LimitMemoryCache) callOnEvict(fn func(key string, value interface{}, reason EvictReason), evicted []cacheEvicted) {
+	if fn == nil {
+		return
+	}
+	for _, v := range evicted {
+		fn(v.key, v.value, v.reason)
+	}
 }
 
 // Close if enable save to file, save()
+// if enable persist, compact and close aof
 func (m *LimitMemoryCache) Close() error {
+	if m.persist != nil {
+		var err error
+		m.persist.once.Do(func() {
+			err = ErrMulti(m.compact(), m.persist.close())
+		})
+		return err
+	}
 	m.rwMutex.Lock()
 	defer m.rwMutex.Unlock()
 	if m.filename != "" {
@@ -489,42 +615,46 @@ func (m *LimitMemoryCache) Close() error {
 	return nil
 }
 
-func (m *LimitMemoryCache) isOverSize(size int32) error {
-	if m.size <= 0 {
-		return nil
+// entrySize 限制了 size 时按 value 格式化后的长度计算, 否则按 cacheEntrySize 估算, 避免格式化开销
+func (m *LimitMemoryCache) entrySize(key string, value interface{}) int32 {
+	if m.size > 0 {
+		return int32(len(key) + len(fmt.Sprint(value)))
 	}
+	return int32(cacheEntrySize(key, value))
+}
 
-	if atomic.LoadInt32(&m.currentSize)+size > m.size {
-		// scan expired del, just del
-		if m.scanExpiredKeyAndDel() >= size {
-			return nil
-		}
-		return ErrCacheSizeOverCapacity
+// goroutine not safety
+func (m *LimitMemoryCache) isOverSize(size int32) bool {
+	if m.size <= 0 {
+		return false
 	}
-	return nil
+	return atomic.LoadInt32(&m.currentSize)+size > m.size
 }
 
-func (m *LimitMemoryCache) scanExpiredKeyAndDel() int32 {
-	var size int32
-	m.rwMutex.RLock()
-	delList := make([]struct {
-		Key string
-		Val IValue
-	}, 0)
+// delExpiredKey goroutine not safety
+func (m *LimitMemoryCache) delExpiredKey() []cacheEvicted {
+	evicted := make([]cacheEvicted, 0)
 	now := time.Now().Unix()
 	for k, v := range m.store {
 		if v.Expired(now) {
-			delList = append(delList, struct {
-				Key string
-				Val IValue
-			}{Key: k, Val: v})
+			delete(m.store, k)
+			atomic.AddInt32(&m.currentSize, -v.Size)
+			m.counter.evict(EvictReasonExpired)
+			evicted = append(evicted, cacheEvicted{key: k, value: v.Value, reason: EvictReasonExpired})
 		}
 	}
-	m.rwMutex.RUnlock()
+	return evicted
+}
 
-	for _, del := range delList {
-		size += m.delete(del.Key, true)
-	}
+func (m *LimitMemoryCache) scanExpiredKeyAndDel() int32 {
+	m.rwMutex.Lock()
+	before := atomic.LoadInt32(&m.currentSize)
+	evicted := m.delExpiredKey()
+	size := before - atomic.LoadInt32(&m.currentSize)
+	fn := m.onEvict
+	m.rwMutex.Unlock()
+
+	m.callOnEvict(fn, evicted)
 	return size
 }
 
@@ -532,8 +662,10 @@ func (m *LimitMemoryCache) scanExpiredKeyAndDel() int32 {
 // when a large number expired keys are set, is suggest for use
 func (m *LimitMemoryCache) runGC() {
 	go func() {
-		time.Sleep(CacheGCInterval)
-		m.scanExpiredKeyAndDel()
+		for {
+			time.Sleep(CacheGCInterval)
+			m.scanExpiredKeyAndDel()
+		}
 	}()
 }
 
@@ -577,6 +709,9 @@ func (m *LimitMemoryCache) load() error {
 	now := time.Now().Unix()
 	for k, v := range values {
 		if !v.Expired(now) {
+			if v.Size == 0 {
+				v.Size = m.entrySize(k, v.Value)
+			}
 			_ = m.set(k, v)
 		}
 	}
@@ -656,19 +791,12 @@ func (d *Disk) ReadFromFile() ([]byte, error) {
 // fetchFn 返回的值如果是指针类型，会将指针解引用后赋值给valPtr, 缓存不会保存指针类型的值，外部修改不影响缓存中的值
 func CacheGetOrSet(c Cacher, ctx context.Context, key string, valPtr interface{}, fetchFn func(context.Context) (interface{}, error), ttl ...time.Duration) error {
 	// valPtr 必须是指针类型, 并且不能是指针nil, 不能是指针的指针
-	if reflect.TypeOf(valPtr).Kind() != reflect.Ptr || reflect.ValueOf(valPtr).IsNil() || reflect.TypeOf(valPtr).Elem().Kind() == reflect.Ptr {
-		return fmt.Errorf("valPtr must be a non-nil pointer to a non-pointer type, but got %T", valPtr)
+	if err := cacheCheckValPtr(valPtr); err != nil {
+		return err
 	}
 	v, err := c.Get(key)
-	if err == nil {
-		// 检查v的类型是否可以赋值给valPtr指向的基础类型
-		vType := reflect.TypeOf(v)
-		valPtrType := reflect.TypeOf(valPtr).Elem() // valPtr指向的类型
-
-		if vType.AssignableTo(valPtrType) {
-			reflect.ValueOf(valPtr).Elem().Set(reflect.ValueOf(v))
-			return nil
-		}
+	if err == nil && cacheAssign(valPtr, v) {
+		return nil
 	}
 	// 如果缓存不存在或者类型不匹配，调用fetchFn
 	if fetchFn != nil {
@@ -679,9 +807,7 @@ func CacheGetOrSet(c Cacher, ctx context.Context, key string, valPtr interface{}
 		if fetchVal == nil {
 			return nil
 		}
-		if reflect.TypeOf(fetchVal).Kind() == reflect.Ptr {
-			fetchVal = reflect.ValueOf(fetchVal).Elem().Interface()
-		}
+		fetchVal = cacheDeref(fetchVal)
 		reflect.ValueOf(valPtr).Elem().Set(reflect.ValueOf(fetchVal))
 		// 将fetchFn的结果写入缓存
 		if len(ttl) > 0 {
@@ -692,3 +818,30 @@ func CacheGetOrSet(c Cacher, ctx context.Context, key string, valPtr interface{}
 	}
 	return nil
 }
+
+func cacheCheckValPtr(valPtr interface{}) error {
+	if valPtr == nil || reflect.TypeOf(valPtr).Kind() != reflect.Ptr || reflect.ValueOf(valPtr).IsNil() || reflect.TypeOf(valPtr).Elem().Kind() == reflect.Ptr {
+		return fmt.Errorf("valPtr must be a non-nil pointer to a non-pointer type, but got %T", valPtr)
+	}
+	return nil
+}
+
+// cacheAssign 检查v的类型是否可以赋值给valPtr指向的基础类型, 可以则赋值
+func cacheAssign(valPtr interface{}, v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if reflect.TypeOf(v).AssignableTo(reflect.TypeOf(valPtr).Elem()) {
+		reflect.ValueOf(valPtr).Elem().Set(reflect.ValueOf(v))
+		return true
+	}
+	return false
+}
+
+// cacheDeref 指针类型解引用, 缓存不保存指针类型的值
+func cacheDeref(v interface{}) interface{} {
+	if reflect.TypeOf(v).Kind() == reflect.Ptr {
+		return reflect.ValueOf(v).Elem().Interface()
+	}
+	return v
+}
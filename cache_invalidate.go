@@ -0,0 +1,287 @@
+package bkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CacheInvalidateOpSet       = "set"
+	CacheInvalidateOpDel       = "del"
+	CacheInvalidateOpDelPrefix = "del_prefix"
+)
+
+// CacheInvalidateEvent 缓存变更事件
+type CacheInvalidateEvent struct {
+	Node string `json:"node" bson:"node"` // 发布节点, 节点忽略自己发布的事件
+	Op   string `json:"op" bson:"op"`
+	Key  string `json:"key" bson:"key"` // Op=del_prefix 时为前缀
+}
+
+// CacheInvalidateTransport 缓存变更事件的传输
+type CacheInvalidateTransport interface {
+	Publish(ctx context.Context, event CacheInvalidateEvent) error
+	// Subscribe 订阅成功后返回, 后台接收事件直到 ctx 结束或 Close
+	Subscribe(ctx context.Context, fn func(event CacheInvalidateEvent)) error
+	Close() error
+}
+
+var _ Cacher = &InvalidateCache{}
+
+// InvalidateCache 跨节点缓存失效, 包装本地 Cacher 或 TieredCache
+// 本节点 Set/Del 后发布事件, 其他节点收到后删除本地对应的 key 或前缀
+// 包装的 Cacher 实现了 Invalidate(key string) (TieredCache) 时, 收到事件调用 Invalidate 只删除本地 L1
+// 节点间共享的缓存(RedisCache)收到其他节点的 Set 事件删除 key 会删除对方刚写入的值, 不能直接包装
+type InvalidateCache struct {
+	c         Cacher
+	transport CacheInvalidateTransport
+	node      string
+
+	cancel func()
+}
+
+// NewInvalidateCache node 为节点唯一标识, 为空时使用 NewRequestID
+func NewInvalidateCache(ctx context.Context, c Cacher, transport CacheInvalidateTransport, node string) (*InvalidateCache, error) {
+	if _, ok := c.(*RedisCache); ok {
+		return nil, fmt.Errorf("invalidate cache requires a local cacher, RedisCache is shared between nodes")
+	}
+	if node == "" {
+		node = NewRequestID().Hex()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m := &InvalidateCache{
+		c:         c,
+		transport: transport,
+		node:      node,
+		cancel:    cancel,
+	}
+	if err := transport.Subscribe(ctx, m.onEvent); err != nil {
+		cancel()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Cacher 包装的缓存
+func (m *InvalidateCache) Cacher() Cacher {
+	return m.c
+}
+
+func (m *InvalidateCache) onEvent(event CacheInvalidateEvent) {
+	if event.Node == m.node {
+		return
+	}
+	switch event.Op {
+	case CacheInvalidateOpSet, CacheInvalidateOpDel:
+		m.invalidate(event.Key)
+	case CacheInvalidateOpDelPrefix:
+		for _, k := range m.prefixKeys(m.local(), event.Key) {
+			m.invalidate(k)
+		}
+	}
+}
+
+func (m *InvalidateCache) invalidate(key string) {
+	if v, ok := m.c.(interface{ Invalidate(key string) }); ok {
+		v.Invalidate(key)
+		return
+	}
+	_ = m.c.Del(key)
+}
+
+// local 收到事件时失效的本地缓存, TieredCache 为 L1
+func (m *InvalidateCache) local() Cacher {
+	if v, ok := m.c.(interface{ L1() Cacher }); ok {
+		return v.L1()
+	}
+	return m.c
+}
+
+// prefixKeys Range 中不能操作缓存, 先收集 key
+func (m *InvalidateCache) prefixKeys(c Cacher, prefix string) []string {
+	keys := make([]string, 0)
+	c.Range(func(key string, value interface{}) bool {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+func (m *InvalidateCache) publish(op, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.transport.Publish(ctx, CacheInvalidateEvent{Node: m.node, Op: op, Key: key})
+}
+
+func (m *InvalidateCache) Get(key string) (interface{}, error) {
+	return m.c.Get(key)
+}
+
+func (m *InvalidateCache) Range(f func(key string, value interface{}) bool) {
+	m.c.Range(f)
+}
+
+func (m *InvalidateCache) Set(key string, value interface{}) error {
+	return m.SetWithTTL(key, value, -1)
+}
+
+func (m *InvalidateCache) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if err := m.c.SetWithTTL(key, value, ttl); err != nil {
+		return err
+	}
+	return m.publish(CacheInvalidateOpSet, key)
+}
+
+func (m *InvalidateCache) Del(key string) error {
+	if err := m.c.Del(key); err != nil {
+		return err
+	}
+	return m.publish(CacheInvalidateOpDel, key)
+}
+
+// DelPrefix 删除前缀匹配的 key, 并通知其他节点
+func (m *InvalidateCache) DelPrefix(prefix string) error {
+	for _, k := range m.prefixKeys(m.c, prefix) {
+		if err := m.c.Del(k); err != nil {
+			return err
+		}
+	}
+	return m.publish(CacheInvalidateOpDelPrefix, prefix)
+}
+
+func (m *InvalidateCache) Close() error {
+	m.cancel()
+	return ErrMulti(m.transport.Close(), m.c.Close())
+}
+
+var _ CacheInvalidateTransport = &MemoryInvalidateTransport{}
+
+// MemoryInvalidateTransport 进程内传输, 同一个实例的所有订阅者都会收到事件, 用于测试或单进程多缓存
+type MemoryInvalidateTransport struct {
+	mutex sync.RWMutex
+	id    int
+	subs  map[int]func(event CacheInvalidateEvent)
+}
+
+func NewMemoryInvalidateTransport() *MemoryInvalidateTransport {
+	return &MemoryInvalidateTransport{
+		subs: make(map[int]func(event CacheInvalidateEvent)),
+	}
+}
+
+// Publish 同步调用所有订阅者
+func (t *MemoryInvalidateTransport) Publish(ctx context.Context, event CacheInvalidateEvent) error {
+	t.mutex.RLock()
+	subs := make([]func(event CacheInvalidateEvent), 0, len(t.subs))
+	for _, fn := range t.subs {
+		subs = append(subs, fn)
+	}
+	t.mutex.RUnlock()
+	for _, fn := range subs {
+		fn(event)
+	}
+	return nil
+}
+
+func (t *MemoryInvalidateTransport) Subscribe(ctx context.Context, fn func(event CacheInvalidateEvent)) error {
+	t.mutex.Lock()
+	t.id++
+	id := t.id
+	t.subs[id] = fn
+	t.mutex.Unlock()
+	go func() {
+		<-ctx.Done()
+		t.mutex.Lock()
+		delete(t.subs, id)
+		t.mutex.Unlock()
+	}()
+	return nil
+}
+
+func (t *MemoryInvalidateTransport) Close() error {
+	return nil
+}
+
+var _ CacheInvalidateTransport = &RedisInvalidateTransport{}
+
+// RedisInvalidateTransport redis pub/sub 传输, 节点离线期间的事件会丢失, 需要配合缓存 TTL 使用
+type RedisInvalidateTransport struct {
+	client  redis.UniversalClient
+	channel string
+
+	mutex sync.Mutex
+	subs  []*redis.PubSub
+}
+
+// NewRedisInvalidateTransport channel 为空默认 bkit:cache:invalidate, client 由调用方管理
+func NewRedisInvalidateTransport(client redis.UniversalClient, channel string) *RedisInvalidateTransport {
+	if channel == "" {
+		channel = "bkit:cache:invalidate"
+	}
+	return &RedisInvalidateTransport{
+		client:  client,
+		channel: channel,
+	}
+}
+
+func (t *RedisInvalidateTransport) Publish(ctx context.Context, event CacheInvalidateEvent) error {
+	byt, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return t.client.Publish(ctx, t.channel, byt).Err()
+}
+
+func (t *RedisInvalidateTransport) Subscribe(ctx context.Context, fn func(event CacheInvalidateEvent)) error {
+	ps := t.client.Subscribe(ctx, t.channel)
+	// 等待订阅确认
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return fmt.Errorf("redis subscribe %s: %w", t.channel, err)
+	}
+	t.mutex.Lock()
+	t.subs = append(t.subs, ps)
+	t.mutex.Unlock()
+
+	go func() {
+		ch := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = ps.Close()
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				event := CacheInvalidateEvent{}
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					log.Printf("WARNING: cache invalidate event %s %s\n", msg.Payload, err.Error())
+					continue
+				}
+				fn(event)
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *RedisInvalidateTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var errs []error
+	for _, ps := range t.subs {
+		errs = append(errs, ps.Close())
+	}
+	t.subs = nil
+	return ErrMulti(errs...)
+}
@@ -0,0 +1,99 @@
+package bkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testInvalidateCache(t *testing.T, transport func() CacheInvalidateTransport, wait time.Duration) {
+	ctx := context.Background()
+	node1, err := NewInvalidateCache(ctx, NewLRUMemory(100), transport(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Close()
+	l2 := NewLimitMemoryCache(-1)
+	node2, err := NewInvalidateCache(ctx, NewTieredCache(NewLRUMemory(100), l2), transport(), "node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node2.Close()
+
+	_ = node1.Set("user:1", 1)
+	_ = node1.Set("user:2", 2)
+	_ = node2.Set("user:1", 1)
+	_ = node2.Set("order:1", 1)
+	time.Sleep(wait)
+	// node2 set, node1 drop
+	if _, err := node1.Get("user:1"); !IsNotFoundErr(err) {
+		t.Fatal("node1 user:1 should invalidated")
+	}
+
+	_ = node1.Set("user:1", 10)
+	time.Sleep(wait)
+	// 只删除 node2 L1, L2 保留
+	tiered := node2.Cacher().(*TieredCache)
+	if _, err := tiered.L1().Get("user:1"); !IsNotFoundErr(err) {
+		t.Fatal("node2 L1 user:1 should invalidated")
+	}
+	if _, err := l2.Get("user:1"); err != nil {
+		t.Fatal("node2 L2 user:1 should keep")
+	}
+
+	_ = node2.Set("user:2", 2)
+	_ = node1.Set("user:2", 2)
+	time.Sleep(wait)
+	if err := node2.DelPrefix("user:"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(wait)
+	if _, err := node1.Get("user:2"); !IsNotFoundErr(err) {
+		t.Fatal("node1 user:2 should invalidated by prefix")
+	}
+	if _, err := node2.Get("order:1"); err != nil {
+		t.Fatal("order:1 should keep")
+	}
+
+	// 其他节点的 DelPrefix 只删除 node2 L1
+	_ = node2.Set("order:2", 2)
+	time.Sleep(wait)
+	if err := node1.DelPrefix("order:"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(wait)
+	if _, err := tiered.L1().Get("order:2"); !IsNotFoundErr(err) {
+		t.Fatal("node2 L1 order:2 should invalidated by prefix")
+	}
+	if _, err := l2.Get("order:2"); err != nil {
+		t.Fatal("node2 L2 order:2 should keep")
+	}
+}
+
+func TestInvalidateCache_Shared(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	if _, err := NewInvalidateCache(context.Background(), NewRedisCache(client), NewMemoryInvalidateTransport(), ""); err == nil {
+		t.Fatal("shared cacher should be rejected")
+	}
+}
+
+func TestInvalidateCache_Memory(t *testing.T) {
+	transport := NewMemoryInvalidateTransport()
+	testInvalidateCache(t, func() CacheInvalidateTransport { return transport }, 0)
+}
+
+func TestInvalidateCache_Redis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	testInvalidateCache(t, func() CacheInvalidateTransport {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		return NewRedisInvalidateTransport(client, "")
+	}, 50*time.Millisecond)
+}
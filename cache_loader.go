@@ -0,0 +1,271 @@
+package bkit
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+func init() {
+	// 空值缓存需要通过序列化的 Cacher(RedisCache) 保存
+	gob.Register(cacheNegative{})
+	gob.Register(cacheStale{})
+}
+
+// cacheNegative 空值缓存标记, fetchFn 返回 nil 或 NotFound 时写入
+type cacheNegative struct {
+	NotFound bool
+}
+
+// cacheStale 开启 SoftTTL 后缓存的值, 记录软过期时间
+type cacheStale struct {
+	Value      interface{}
+	SoftExpire int64 // UnixNano
+}
+
+func (v cacheStale) Stale(now time.Time) bool {
+	return now.UnixNano() > v.SoftExpire
+}
+
+type CacheLoaderConf struct {
+	TTL         time.Duration // 缓存时间, <=0 不过期, 开启 SoftTTL 后为硬过期时间
+	NegativeTTL time.Duration // fetchFn 返回 nil 或 NotFound 错误时, 空结果的缓存时间, <=0 不缓存空结果
+
+	// SoftTTL 软过期时间, >0 开启 stale-while-revalidate
+	// 超过 SoftTTL 未超过 TTL 时直接返回旧值, 后台调用 fetchFn 刷新
+	SoftTTL time.Duration
+	// RefreshAheadHits 软过期前 RefreshAheadWindow 内访问次数达到该值, 提前后台刷新, 0 不开启
+	RefreshAheadHits int
+	// RefreshAheadWindow 默认 SoftTTL/5
+	RefreshAheadWindow time.Duration
+	// RefreshTimeout 后台刷新超时时间, 默认 30s
+	RefreshTimeout time.Duration
+	// OnRefreshErr 后台刷新失败回调, 失败不会删除旧值
+	OnRefreshErr func(key string, err error)
+	// FetchTimeout 并发 miss 共享的 fetchFn 超时时间, 默认 30s
+	// fetchFn 不跟随单个调用的 ctx 取消, 每个调用按自己的 ctx 返回
+	FetchTimeout time.Duration
+}
+
+func (c *CacheLoaderConf) Validate() error {
+	if c.TTL <= 0 {
+		c.TTL = -1
+	}
+	if c.FetchTimeout <= 0 {
+		c.FetchTimeout = 30 * time.Second
+	}
+	if c.SoftTTL > 0 {
+		if c.TTL > 0 && c.SoftTTL > c.TTL {
+			c.SoftTTL = c.TTL
+		}
+		if c.RefreshAheadWindow <= 0 {
+			c.RefreshAheadWindow = c.SoftTTL / 5
+		}
+		if c.RefreshTimeout <= 0 {
+			c.RefreshTimeout = 30 * time.Second
+		}
+	}
+	return nil
+}
+
+// CacheLoader 与 CacheGetOrSet 语义一致, 同一个 key 的并发 miss 只调用一次 fetchFn, 其他调用等待结果, 防止缓存击穿
+// 开启 NegativeTTL 后, 不存在的数据也会缓存, 防止缓存穿透
+// 开启 SoftTTL 后, 软过期的值直接返回并后台刷新, 适合配置类数据
+type CacheLoader struct {
+	cfg   *CacheLoaderConf
+	c     Cacher
+	group singleflight.Group
+
+	mutex      sync.Mutex
+	hits       map[string]int // 软过期窗口内的访问次数
+	refreshing map[string]bool
+}
+
+func NewCacheLoader(c Cacher, cfg ...*CacheLoaderConf) *CacheLoader {
+	conf := &CacheLoaderConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &CacheLoader{
+		cfg:        conf,
+		c:          c,
+		hits:       make(map[string]int),
+		refreshing: make(map[string]bool),
+	}
+}
+
+// Cacher 底层缓存
+func (l *CacheLoader) Cacher() Cacher {
+	return l.c
+}
+
+// GetOrSet valPtr 要求同 CacheGetOrSet
+// 命中空值缓存时, fetchFn 当时返回 NotFound 错误则返回 ErrNotFound, 返回 nil 则返回 nil 且 valPtr 不赋值
+func (l *CacheLoader) GetOrSet(ctx context.Context, key string, valPtr interface{}, fetchFn func(context.Context) (interface{}, error)) error {
+	if err := cacheCheckValPtr(valPtr); err != nil {
+		return err
+	}
+	if hit, err := l.get(ctx, key, valPtr, fetchFn); hit {
+		return err
+	}
+	if fetchFn == nil {
+		return nil
+	}
+
+	ch := l.group.DoChan(key, func() (interface{}, error) {
+		// 等待期间其他调用可能已经写入缓存
+		if v, err := l.c.Get(key); err == nil {
+			if stale, ok := v.(cacheStale); ok {
+				if !stale.Stale(time.Now()) {
+					return stale.Value, nil
+				}
+			} else if _, ok := v.(cacheNegative); ok || reflect.TypeOf(v).AssignableTo(reflect.TypeOf(valPtr).Elem()) {
+				return v, nil
+			}
+		}
+		// 第一个调用取消不影响其他等待的调用
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.cfg.FetchTimeout)
+		defer cancel()
+		return l.fetch(fetchCtx, key, fetchFn)
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ret := <-ch:
+		if ret.Err != nil {
+			return ret.Err
+		}
+		return l.assign(valPtr, ret.Val)
+	}
+}
+
+func (l *CacheLoader) fetch(ctx context.Context, key string, fetchFn func(context.Context) (interface{}, error)) (interface{}, error) {
+	fetchVal, err := fetchFn(ctx)
+	if err != nil {
+		if IsNotFoundErr(err) && l.cfg.NegativeTTL > 0 {
+			_ = l.c.SetWithTTL(key, cacheNegative{NotFound: true}, l.cfg.NegativeTTL)
+		}
+		return nil, err
+	}
+	if fetchVal == nil {
+		if l.cfg.NegativeTTL > 0 {
+			_ = l.c.SetWithTTL(key, cacheNegative{}, l.cfg.NegativeTTL)
+		}
+		return nil, nil
+	}
+	fetchVal = cacheDeref(fetchVal)
+	if l.cfg.SoftTTL > 0 {
+		_ = l.c.SetWithTTL(key, cacheStale{Value: fetchVal, SoftExpire: time.Now().Add(l.cfg.SoftTTL).UnixNano()}, l.cfg.TTL)
+	} else {
+		_ = l.c.SetWithTTL(key, fetchVal, l.cfg.TTL)
+	}
+	return fetchVal, nil
+}
+
+// refresh 后台刷新, 同一个 key 同时只有一个刷新, 失败保留旧值
+func (l *CacheLoader) refresh(ctx context.Context, key string, fetchFn func(context.Context) (interface{}, error)) {
+	if fetchFn == nil {
+		return
+	}
+	l.mutex.Lock()
+	if l.refreshing[key] {
+		l.mutex.Unlock()
+		return
+	}
+	l.refreshing[key] = true
+	delete(l.hits, key)
+	l.mutex.Unlock()
+
+	// 不跟随请求的 ctx 取消
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.cfg.RefreshTimeout)
+	go func() {
+		defer func() {
+			cancel()
+			l.mutex.Lock()
+			delete(l.refreshing, key)
+			l.mutex.Unlock()
+		}()
+		_, err, _ := l.group.Do(key, func() (interface{}, error) {
+			fetchVal, err := fetchFn(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if fetchVal == nil {
+				return nil, nil
+			}
+			fetchVal = cacheDeref(fetchVal)
+			_ = l.c.SetWithTTL(key, cacheStale{Value: fetchVal, SoftExpire: time.Now().Add(l.cfg.SoftTTL).UnixNano()}, l.cfg.TTL)
+			return fetchVal, nil
+		})
+		if err != nil && l.cfg.OnRefreshErr != nil {
+			l.cfg.OnRefreshErr(key, err)
+		}
+	}()
+}
+
+// refreshAhead 软过期前的访问计数, 达到 RefreshAheadHits 返回 true
+func (l *CacheLoader) refreshAhead(key string, stale cacheStale, now time.Time) bool {
+	if l.cfg.RefreshAheadHits <= 0 || stale.SoftExpire-now.UnixNano() > int64(l.cfg.RefreshAheadWindow) {
+		return false
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.hits[key]++
+	return l.hits[key] >= l.cfg.RefreshAheadHits
+}
+
+// get 命中返回 true, 软过期或即将软过期时后台刷新
+func (l *CacheLoader) get(ctx context.Context, key string, valPtr interface{}, fetchFn func(context.Context) (interface{}, error)) (bool, error) {
+	v, err := l.c.Get(key)
+	if err != nil {
+		return false, nil
+	}
+	if stale, ok := v.(cacheStale); ok {
+		if !cacheAssign(valPtr, stale.Value) {
+			return false, nil
+		}
+		now := time.Now()
+		if stale.Stale(now) || l.refreshAhead(key, stale, now) {
+			l.refresh(ctx, key, fetchFn)
+		}
+		return true, nil
+	}
+	if neg, ok := v.(cacheNegative); ok {
+		if neg.NotFound {
+			return true, ErrNotFound
+		}
+		return true, nil
+	}
+	return cacheAssign(valPtr, v), nil
+}
+
+func (l *CacheLoader) assign(valPtr interface{}, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if neg, ok := v.(cacheNegative); ok {
+		if neg.NotFound {
+			return ErrNotFound
+		}
+		return nil
+	}
+	if !cacheAssign(valPtr, v) {
+		return fmt.Errorf("cache value type %T not assignable to %T", v, valPtr)
+	}
+	return nil
+}
+
+// Del 删除缓存, 包括空值缓存
+func (l *CacheLoader) Del(key string) error {
+	l.mutex.Lock()
+	delete(l.hits, key)
+	l.mutex.Unlock()
+	return l.c.Del(key)
+}
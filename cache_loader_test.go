@@ -0,0 +1,200 @@
+package bkit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheLoader_Singleflight(t *testing.T) {
+	l := NewCacheLoader(NewLRUMemory(100), &CacheLoaderConf{TTL: time.Minute})
+	var fetchCount int32
+	fetchFn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&fetchCount, 1)
+		time.Sleep(50 * time.Millisecond)
+		return 10, nil
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var val int
+			if err := l.GetOrSet(context.Background(), "key", &val, fetchFn); err != nil {
+				t.Error(err)
+				return
+			}
+			if val != 10 {
+				t.Error("should equal")
+			}
+		}()
+	}
+	wg.Wait()
+	if fetchCount != 1 {
+		t.Fatalf("fetchFn should call once, got %d", fetchCount)
+	}
+}
+
+func TestCacheLoader_FirstCallerCancel(t *testing.T) {
+	l := NewCacheLoader(NewLRUMemory(100), &CacheLoaderConf{TTL: time.Minute})
+	fetchFn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			return 10, nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		var val int
+		first <- l.GetOrSet(ctx, "key", &val, fetchFn)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan error, 1)
+	var val int
+	go func() {
+		second <- l.GetOrSet(context.Background(), "key", &val, fetchFn)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	if err := <-second; err != nil || val != 10 {
+		t.Fatalf("waiter should get value, got %v %d", err, val)
+	}
+
+	// 共享结果类型不匹配返回错误
+	var s string
+	if err := l.GetOrSet(context.Background(), "other", &s, func(ctx context.Context) (interface{}, error) {
+		return 1, nil
+	}); err == nil {
+		t.Fatal("expect type mismatch error")
+	}
+}
+
+func TestCacheLoader_Negative(t *testing.T) {
+	l := NewCacheLoader(NewLRUMemory(100), &CacheLoaderConf{NegativeTTL: time.Minute})
+	fetchCount := 0
+	notFoundFn := func(ctx context.Context) (interface{}, error) {
+		fetchCount++
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		var val int
+		if err := l.GetOrSet(context.Background(), "not_found", &val, notFoundFn); !IsNotFoundErr(err) {
+			t.Fatalf("should not found, got %v", err)
+		}
+	}
+	if fetchCount != 1 {
+		t.Fatalf("fetchFn should call once, got %d", fetchCount)
+	}
+
+	nilFn := func(ctx context.Context) (interface{}, error) {
+		fetchCount++
+		return nil, nil
+	}
+	for i := 0; i < 3; i++ {
+		var val int
+		if err := l.GetOrSet(context.Background(), "nil", &val, nilFn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetchCount != 2 {
+		t.Fatalf("fetchFn should call twice, got %d", fetchCount)
+	}
+
+	// 未开启空值缓存
+	l = NewCacheLoader(NewLRUMemory(100))
+	fetchCount = 0
+	for i := 0; i < 3; i++ {
+		var val int
+		_ = l.GetOrSet(context.Background(), "not_found", &val, notFoundFn)
+	}
+	if fetchCount != 3 {
+		t.Fatalf("fetchFn should call 3 times, got %d", fetchCount)
+	}
+}
+
+func TestCacheLoader_StaleWhileRevalidate(t *testing.T) {
+	refreshErr := make(chan error, 1)
+	l := NewCacheLoader(NewShardedCache(), &CacheLoaderConf{
+		TTL:     time.Minute,
+		SoftTTL: 50 * time.Millisecond,
+		OnRefreshErr: func(key string, err error) {
+			refreshErr <- err
+		},
+	})
+	var version int32
+	fetchFn := func(ctx context.Context) (interface{}, error) {
+		v := atomic.AddInt32(&version, 1)
+		if v == 3 {
+			return nil, ErrFailed
+		}
+		return int(v), nil
+	}
+	get := func() int {
+		var val int
+		if err := l.GetOrSet(context.Background(), "key", &val, fetchFn); err != nil {
+			t.Fatal(err)
+		}
+		return val
+	}
+	if get() != 1 {
+		t.Fatal("should load")
+	}
+	time.Sleep(60 * time.Millisecond)
+	// 软过期返回旧值, 后台刷新
+	if get() != 1 {
+		t.Fatal("should return stale value")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if get() != 2 {
+		t.Fatal("should refreshed")
+	}
+
+	// 刷新失败保留旧值
+	time.Sleep(60 * time.Millisecond)
+	if get() != 2 {
+		t.Fatal("should return stale value")
+	}
+	select {
+	case <-refreshErr:
+	case <-time.After(time.Second):
+		t.Fatal("should report refresh error")
+	}
+	if get() != 2 {
+		t.Fatal("refresh failed should keep last good value")
+	}
+}
+
+func TestCacheLoader_RefreshAhead(t *testing.T) {
+	l := NewCacheLoader(NewShardedCache(), &CacheLoaderConf{
+		SoftTTL:            200 * time.Millisecond,
+		RefreshAheadHits:   3,
+		RefreshAheadWindow: 150 * time.Millisecond,
+	})
+	var version int32
+	fetchFn := func(ctx context.Context) (interface{}, error) {
+		return int(atomic.AddInt32(&version, 1)), nil
+	}
+	var val int
+	_ = l.GetOrSet(context.Background(), "key", &val, fetchFn)
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		_ = l.GetOrSet(context.Background(), "key", &val, fetchFn)
+	}
+	time.Sleep(20 * time.Millisecond)
+	// 未软过期, 已经提前刷新
+	if v := atomic.LoadInt32(&version); v != 2 {
+		t.Fatalf("should refresh ahead, version %d", v)
+	}
+	_ = l.GetOrSet(context.Background(), "key", &val, fetchFn)
+	if val != 2 {
+		t.Fatalf("should get refreshed value, got %d", val)
+	}
+}
@@ -0,0 +1,518 @@
+package bkit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheFsyncPolicy 持久化刷盘策略
+type CacheFsyncPolicy int
+
+const (
+	CacheFsyncEverySec CacheFsyncPolicy = iota // 每秒刷盘, 机器宕机最多丢失1秒数据
+	CacheFsyncAlways                           // 每次写入刷盘, 最安全, 性能最差
+	CacheFsyncNo                               // 不主动刷盘, 由操作系统决定, 进程崩溃不丢数据
+)
+
+// RegisterCacheType 注册缓存值的具体类型, 持久化重新加载后保持原类型
+// 默认 GobCacheCodec 基于 gob, 等同于 gob.Register
+func RegisterCacheType(v ...interface{}) {
+	for _, val := range v {
+		gob.Register(val)
+	}
+}
+
+type CachePersistConf struct {
+	Dir             string           // 持久化目录, 保存 snapshot 与 aof 文件
+	Fsync           CacheFsyncPolicy // 刷盘策略, 默认 CacheFsyncEverySec
+	CompactInterval time.Duration    // 检查压缩的间隔, 默认 10m
+	CompactMinSize  int64            // aof 文件超过该大小才压缩, 默认 4MB
+	Codec           CacheCodec       // 值编解码, 默认 GobCacheCodec, 自定义类型需要 RegisterCacheType
+}
+
+func (c *CachePersistConf) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("Dir required")
+	}
+	if c.CompactInterval <= 0 {
+		c.CompactInterval = 10 * time.Minute
+	}
+	if c.CompactMinSize <= 0 {
+		c.CompactMinSize = 4 << 20
+	}
+	if c.Codec == nil {
+		c.Codec = GobCacheCodec{}
+	}
+	return nil
+}
+
+const (
+	cacheSnapshotFile = "cache.snapshot"
+	cacheAOFFile      = "cache.aof"
+	cacheAOFNextFile  = "cache.aof.next"
+
+	cacheRecordMaxSize = 512 << 20
+
+	cacheOpSet byte = 1
+	cacheOpDel byte = 2
+)
+
+// cachePersister 增量持久化
+// 每次写入追加到 aof, 定期把全量数据写入 snapshot 并清空 aof
+// 压缩时新的写入切换到 aof.next, snapshot 写临时文件后 rename, 任意时刻崩溃都可以通过 snapshot + aof + aof.next 恢复
+type cachePersister struct {
+	cfg *CachePersistConf
+
+	compactMutex sync.Mutex
+
+	mutex   sync.Mutex
+	aof     *os.File
+	aofSize int64
+	dirty   bool
+	// 上次压缩未完成, 写入仍在 aof.next
+	pending bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once // Close 只执行一次
+}
+
+func newCachePersister(cfg *CachePersistConf) (*cachePersister, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &cachePersister{
+		cfg:  cfg,
+		done: make(chan struct{}),
+	}, nil
+}
+
+// NewLimitMemoryCacheWithPersist 增量持久化, 每次写入追加到 aof, 进程崩溃重启后可恢复
+// size=-1 not limit
+func NewLimitMemoryCacheWithPersist(size int32, cfg *CachePersistConf) (*LimitMemoryCache, error) {
+	p, err := newCachePersister(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := &LimitMemoryCache{
+		store:       make(map[string]IValue),
+		size:        -1,
+		currentSize: 0,
+	}
+	if size > 0 {
+		m.size = size
+	}
+
+	values := make(map[string]IValue)
+	if err := p.load(func(op byte, key string, val IValue) {
+		switch op {
+		case cacheOpSet:
+			values[key] = val
+		case cacheOpDel:
+			delete(values, key)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	for k, v := range values {
+		if !v.Expired(now) {
+			if v.Size == 0 {
+				v.Size = m.entrySize(k, v.Value)
+			}
+			_ = m.set(k, v)
+		}
+	}
+
+	// 加载完成后压缩, 之后的写入追加到新的 aof
+	m.persist = p
+	if err := m.compact(); err != nil {
+		_ = p.close()
+		return nil, err
+	}
+	p.runFsync()
+	m.runCompact()
+	m.runGC()
+
+	return m, nil
+}
+
+// compact 内存数据写入 snapshot, 复制数据时持有读锁, 写 snapshot 不阻塞读写
+func (m *LimitMemoryCache) compact() error {
+	m.persist.compactMutex.Lock()
+	defer m.persist.compactMutex.Unlock()
+
+	m.rwMutex.RLock()
+	store := make(map[string]IValue, len(m.store))
+	for k, v := range m.store {
+		store[k] = v
+	}
+	err := m.persist.switchNext()
+	m.rwMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	return m.persist.compact(store)
+}
+
+// runCompact aof 超过 CompactMinSize 时压缩
+func (m *LimitMemoryCache) runCompact() {
+	p := m.persist
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.cfg.CompactInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				if p.size() < p.cfg.CompactMinSize {
+					continue
+				}
+				if err := m.compact(); err != nil {
+					log.Printf("WARNING: cache persist compact %s\n", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+func (p *cachePersister) path(name string) string {
+	return filepath.Join(p.cfg.Dir, name)
+}
+
+// load 按 snapshot, aof, aof.next 顺序回放, 记录可重复回放
+// aof.next 非空说明上次压缩未完成, 其中的记录只存在于 aof.next, 标记 pending 避免下次压缩截断
+func (p *cachePersister) load(apply func(op byte, key string, val IValue)) error {
+	for _, name := range []string{cacheSnapshotFile, cacheAOFFile, cacheAOFNextFile} {
+		if err := p.replay(p.path(name), apply); err != nil {
+			return fmt.Errorf("replay %s: %w", name, err)
+		}
+	}
+	info, err := os.Stat(p.path(cacheAOFNextFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() > 0 {
+		p.mutex.Lock()
+		p.pending = true
+		p.mutex.Unlock()
+	}
+	return nil
+}
+
+func (p *cachePersister) replay(filename string, apply func(op byte, key string, val IValue)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		payload, err := readCacheRecord(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF || err == errCacheRecordCorrupted {
+				// 崩溃导致最后一条记录不完整, 丢弃
+				log.Printf("WARNING: cache persist %s tail record %s, ignored\n", filename, err.Error())
+				return nil
+			}
+			return err
+		}
+		op, key, val, err := p.decodeRecord(payload)
+		if err != nil {
+			log.Printf("WARNING: cache persist %s decode record %s, ignored\n", filename, err.Error())
+			continue
+		}
+		apply(op, key, val)
+	}
+}
+
+// appendSet 需要在缓存写锁内调用, 保证与内存中的顺序一致
+func (p *cachePersister) appendSet(key string, val IValue) error {
+	payload, err := p.encodeRecord(cacheOpSet, key, val)
+	if err != nil {
+		return err
+	}
+	return p.write(payload)
+}
+
+// appendDel 需要在缓存写锁内调用
+func (p *cachePersister) appendDel(key string) error {
+	payload, err := p.encodeRecord(cacheOpDel, key, IValue{})
+	if err != nil {
+		return err
+	}
+	return p.write(payload)
+}
+
+func (p *cachePersister) write(payload []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.aof == nil {
+		return fmt.Errorf("cache persist closed")
+	}
+	n, err := writeCacheRecord(p.aof, payload)
+	p.aofSize += int64(n)
+	if err != nil {
+		return err
+	}
+	if p.cfg.Fsync == CacheFsyncAlways {
+		return p.aof.Sync()
+	}
+	p.dirty = true
+	return nil
+}
+
+func (p *cachePersister) size() int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.aofSize
+}
+
+// switchNext 压缩开始, 后续写入切换到 aof.next, 需要在缓存锁内调用, 与 snapshot 的数据复制保持原子
+func (p *cachePersister) switchNext() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.pending {
+		// 上次压缩失败, aof.next 中的记录没有进入 snapshot, 不能截断, 继续写入
+		if p.aof != nil {
+			return nil
+		}
+		// 启动时 aof.next 非空, 追加写入
+		next, err := os.OpenFile(p.path(cacheAOFNextFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := next.Stat()
+		if err != nil {
+			_ = next.Close()
+			return err
+		}
+		p.aof = next
+		p.aofSize = info.Size()
+		return nil
+	}
+	next, err := os.OpenFile(p.path(cacheAOFNextFile), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if p.aof != nil {
+		_ = p.aof.Sync()
+		_ = p.aof.Close()
+	}
+	p.aof = next
+	p.aofSize = 0
+	p.dirty = false
+	p.pending = true
+	return nil
+}
+
+// compact 写入 snapshot, 成功后 aof.next 替换 aof
+func (p *cachePersister) compact(store map[string]IValue) error {
+	tmp := p.path(cacheSnapshotFile + ".tmp")
+	if err := p.writeSnapshot(tmp, store); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, p.path(cacheSnapshotFile)); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := os.Rename(p.path(cacheAOFNextFile), p.path(cacheAOFFile)); err != nil {
+		return err
+	}
+	p.pending = false
+	return syncDir(p.cfg.Dir)
+}
+
+func (p *cachePersister) writeSnapshot(filename string, store map[string]IValue) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	now := time.Now().Unix()
+	for k, v := range store {
+		if v.Expired(now) {
+			continue
+		}
+		payload, err := p.encodeRecord(cacheOpSet, k, v)
+		if err != nil {
+			log.Printf("WARNING: cache persist snapshot key %s %s, ignored\n", k, err.Error())
+			continue
+		}
+		if _, err := writeCacheRecord(w, payload); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// runFsync CacheFsyncEverySec 每秒刷盘
+func (p *cachePersister) runFsync() {
+	if p.cfg.Fsync != CacheFsyncEverySec {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.sync()
+			}
+		}
+	}()
+}
+
+func (p *cachePersister) sync() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.aof != nil && p.dirty {
+		if err := p.aof.Sync(); err != nil {
+			log.Printf("WARNING: cache persist fsync %s\n", err.Error())
+		}
+		p.dirty = false
+	}
+}
+
+func (p *cachePersister) close() error {
+	close(p.done)
+	p.wg.Wait()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.aof == nil {
+		return nil
+	}
+	err := ErrMulti(p.aof.Sync(), p.aof.Close())
+	p.aof = nil
+	return err
+}
+
+// record payload: op(1) | keyLen(uvarint) | key | [expired(8) | size(4) | value]
+func (p *cachePersister) encodeRecord(op byte, key string, val IValue) ([]byte, error) {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(key)+12)
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	if op == cacheOpSet {
+		value, err := p.cfg.Codec.Marshal(val.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint64(buf, uint64(val.ExpiredTime.UnixNano()))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(val.Size))
+		buf = append(buf, value...)
+	}
+	return buf, nil
+}
+
+func (p *cachePersister) decodeRecord(payload []byte) (byte, string, IValue, error) {
+	val := IValue{}
+	if len(payload) < 1 {
+		return 0, "", val, errCacheRecordCorrupted
+	}
+	op := payload[0]
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < keyLen {
+		return 0, "", val, errCacheRecordCorrupted
+	}
+	offset := 1 + n
+	key := string(payload[offset : offset+int(keyLen)])
+	offset += int(keyLen)
+	switch op {
+	case cacheOpDel:
+		return op, key, val, nil
+	case cacheOpSet:
+		if len(payload)-offset < 12 {
+			return 0, "", val, errCacheRecordCorrupted
+		}
+		val.ExpiredTime = time.Unix(0, int64(binary.BigEndian.Uint64(payload[offset:])))
+		val.Size = int32(binary.BigEndian.Uint32(payload[offset+8:]))
+		v, err := p.cfg.Codec.Unmarshal(payload[offset+12:])
+		if err != nil {
+			return 0, "", val, err
+		}
+		val.Value = v
+		return op, key, val, nil
+	}
+	return 0, "", val, fmt.Errorf("unknown op %d", op)
+}
+
+var errCacheRecordCorrupted = errors.New("record corrupted")
+
+// record: payloadLen(4) | crc32(4) | payload
+func writeCacheRecord(w io.Writer, payload []byte) (int, error) {
+	buf := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+	return w.Write(buf)
+}
+
+func readCacheRecord(r io.Reader) ([]byte, error) {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head[0:4])
+	if size > cacheRecordMaxSize {
+		return nil, errCacheRecordCorrupted
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(head[4:8]) {
+		return nil, errCacheRecordCorrupted
+	}
+	return payload, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// 部分系统不支持目录 fsync, 忽略错误
+	_ = d.Sync()
+	return nil
+}
@@ -0,0 +1,128 @@
+package bkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type persistVal struct {
+	Name string
+	Tags []string
+}
+
+func init() {
+	RegisterCacheType(persistVal{})
+}
+
+func TestLimitMemoryCacheWithPersist(t *testing.T) {
+	dir := t.TempDir()
+	cfg := func() *CachePersistConf {
+		return &CachePersistConf{Dir: dir, Fsync: CacheFsyncAlways}
+	}
+	m, err := NewLimitMemoryCacheWithPersist(-1, cfg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = m.Set("struct", persistVal{Name: "a", Tags: []string{"t1"}})
+	_ = m.Set("int", 1)
+	_ = m.Set("del", 1)
+	_ = m.Del("del")
+	_ = m.SetWithTTL("ttl", 1, time.Second)
+
+	// 模拟崩溃, 不调用 Close, 并写入不完整的记录
+	f, err := os.OpenFile(filepath.Join(dir, cacheAOFFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 10, 1, 2})
+	_ = f.Close()
+	time.Sleep(2 * time.Second)
+
+	check := func(m *LimitMemoryCache) {
+		v, err := m.Get("struct")
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, ok := v.(persistVal)
+		if !ok || val.Name != "a" || val.Tags[0] != "t1" {
+			t.Fatalf("should keep type, got %T %v", v, v)
+		}
+		if v, _ := m.Get("int"); v != 1 {
+			t.Fatalf("should equal, got %v", v)
+		}
+		if _, err := m.Get("del"); !IsNotFoundErr(err) {
+			t.Fatal("should deleted")
+		}
+		if _, err := m.Get("ttl"); !IsNotFoundErr(err) {
+			t.Fatal("should expired")
+		}
+	}
+
+	m1, err := NewLimitMemoryCacheWithPersist(-1, cfg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(m1)
+	_ = m1.Set("after", "compact")
+	if err := m1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 重复 Close 不会 panic
+	if err := m1.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewLimitMemoryCacheWithPersist(-1, cfg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close()
+	check(m2)
+	if v, _ := m2.Get("after"); v != "compact" {
+		t.Fatalf("should equal, got %v", v)
+	}
+}
+
+func TestLimitMemoryCacheWithPersist_StartupCompactCrash(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &CachePersistConf{Dir: dir, Fsync: CacheFsyncAlways}
+	m, err := NewLimitMemoryCacheWithPersist(-1, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = m.Set("a", 1)
+	// 模拟压缩切换到 aof.next 后崩溃, c 只存在于 aof.next
+	if err := m.persist.switchNext(); err != nil {
+		t.Fatal(err)
+	}
+	_ = m.Set("c", 3)
+	_ = m.persist.close()
+
+	// 启动压缩在切换 aof.next 之后, rename snapshot 之前失败
+	tmp := filepath.Join(dir, cacheSnapshotFile+".tmp")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "x"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLimitMemoryCacheWithPersist(-1, &CachePersistConf{Dir: dir, Fsync: CacheFsyncAlways}); err == nil {
+		t.Fatal("expect compact error")
+	}
+	if err := os.RemoveAll(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = NewLimitMemoryCacheWithPersist(-1, &CachePersistConf{Dir: dir, Fsync: CacheFsyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for k, want := range map[string]int{"a": 1, "c": 3} {
+		if v, err := m.Get(k); err != nil || v != want {
+			t.Fatalf("%s should recovered, got %v %v", k, v, err)
+		}
+	}
+}
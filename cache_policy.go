@@ -0,0 +1,591 @@
+package bkit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy 缓存淘汰策略, goroutine not safety, 由缓存加锁后调用
+type EvictionPolicy interface {
+	// SetCapacity 设置容量, 缓存创建时调用
+	SetCapacity(capacity int)
+	// Access 记录一次读取, key 可能不在缓存中
+	Access(key string)
+	// Add 新增 key, 返回需要淘汰的 key, admitted=false 表示新 key 未被准入, 不保存
+	Add(key string) (evicted []string, admitted bool)
+	// Remove 主动删除 key
+	Remove(key string)
+	Len() int
+}
+
+var (
+	_ EvictionPolicy = NewLRUPolicy()
+	_ EvictionPolicy = NewLFUPolicy()
+	_ EvictionPolicy = NewTinyLFUPolicy()
+)
+
+var _ Cacher = &PolicyCache{}
+
+// PolicyCache 淘汰策略可选的缓存, 通过 NewCacheWithPolicy 创建
+type PolicyCache struct {
+	mutex      sync.Mutex
+	store      CacheStore
+	policy     EvictionPolicy
+	expires    map[string]int64 // UnixNano, 0 不过期
+	sizes      map[string]int64
+	bytes      int64
+	MaxElement int
+
+	counter cacheCounter
+	onEvict func(key string, value interface{}, reason EvictReason)
+	evicted []cacheEvicted
+}
+
+// NewCacheWithPolicy maxElement min set 100, policy nil 使用 LRU
+//
+//	c := NewCacheWithPolicy(NewMemoryStore(), 10000, NewTinyLFUPolicy())
+func NewCacheWithPolicy(store CacheStore, maxElement int, policy EvictionPolicy) *PolicyCache {
+	m := &PolicyCache{
+		store:      store,
+		policy:     policy,
+		expires:    make(map[string]int64),
+		sizes:      make(map[string]int64),
+		MaxElement: 100,
+	}
+	if maxElement > m.MaxElement {
+		m.MaxElement = maxElement
+	}
+	if m.policy == nil {
+		m.policy = NewLRUPolicy()
+	}
+	m.policy.SetCapacity(m.MaxElement)
+	m.runGC()
+	return m
+}
+
+func (m *PolicyCache) runGC() {
+	go func() {
+		for {
+			time.Sleep(CacheGCInterval)
+			m.GC()
+		}
+	}()
+}
+
+// GC 删除所有过期 key
+func (m *PolicyCache) GC() {
+	m.mutex.Lock()
+	defer m.unlock()
+	now := time.Now().UnixNano()
+	for k, expired := range m.expires {
+		if expired > 0 && now > expired {
+			m.policy.Remove(k)
+			m.evict(k, EvictReasonExpired)
+		}
+	}
+}
+
+// OnEvict 设置淘汰回调, 超出容量淘汰和过期删除时调用, 主动 Del 不调用
+func (m *PolicyCache) OnEvict(fn func(key string, value interface{}, reason EvictReason)) {
+	m.mutex.Lock()
+	m.onEvict = fn
+	m.mutex.Unlock()
+}
+
+// Stats 缓存统计, Bytes 按 cacheEntrySize 估算
+func (m *PolicyCache) Stats() CacheStats {
+	s := m.counter.stats()
+	m.mutex.Lock()
+	s.Entries = int64(len(m.expires))
+	s.Bytes = m.bytes
+	m.mutex.Unlock()
+	return s
+}
+
+// unlock 释放锁后, 回调淘汰的条目
+func (m *PolicyCache) unlock() {
+	evicted, fn := m.evicted, m.onEvict
+	m.evicted = nil
+	m.mutex.Unlock()
+	if fn == nil {
+		return
+	}
+	for _, v := range evicted {
+		fn(v.key, v.value, v.reason)
+	}
+}
+
+// goroutine not safety, policy 中已经删除
+func (m *PolicyCache) evict(key string, reason EvictReason) {
+	m.remove(key)
+	m.counter.evict(reason)
+	if m.onEvict != nil {
+		v, _ := m.store.Get(key)
+		m.evicted = append(m.evicted, cacheEvicted{key: key, value: v, reason: reason})
+	}
+	_ = m.store.Del(key)
+}
+
+func (m *PolicyCache) Get(key string) (interface{}, error) {
+	m.mutex.Lock()
+	v, err := m.get(key)
+	m.unlock()
+	m.counter.hit(err == nil)
+	return v, err
+}
+
+// goroutine not safety
+func (m *PolicyCache) get(key string) (interface{}, error) {
+	m.policy.Access(key)
+	expired, ok := m.expires[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if expired > 0 && time.Now().UnixNano() > expired {
+		m.policy.Remove(key)
+		m.evict(key, EvictReasonExpired)
+		return nil, ErrNotFound
+	}
+	return m.store.Get(key)
+}
+
+func (m *PolicyCache) Set(key string, value interface{}) error {
+	return m.SetWithTTL(key, value, -1)
+}
+
+// SetWithTTL 未被淘汰策略准入的 key 不保存, 返回 nil
+func (m *PolicyCache) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	expired := int64(0)
+	if ttl > 0 {
+		expired = time.Now().Add(ttl).UnixNano()
+	}
+	m.mutex.Lock()
+	defer m.unlock()
+	if _, ok := m.expires[key]; !ok {
+		evicted, admitted := m.policy.Add(key)
+		for _, k := range evicted {
+			if k != key {
+				m.evict(k, EvictReasonCapacity)
+			}
+		}
+		if !admitted {
+			return nil
+		}
+	}
+	m.expires[key] = expired
+	size := cacheEntrySize(key, value)
+	m.bytes += size - m.sizes[key]
+	m.sizes[key] = size
+	return m.store.Set(key, value)
+}
+
+func (m *PolicyCache) Range(fn func(key string, value interface{}) bool) {
+	m.mutex.Lock()
+	defer m.unlock()
+	now := time.Now().UnixNano()
+	for k, expired := range m.expires {
+		if expired > 0 && now > expired {
+			continue
+		}
+		v, err := m.store.Get(k)
+		if err == nil {
+			if !fn(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func (m *PolicyCache) Del(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.expires[key]; ok {
+		m.policy.Remove(key)
+		m.remove(key)
+	}
+	return m.store.Del(key)
+}
+
+// goroutine not safety
+func (m *PolicyCache) remove(key string) {
+	delete(m.expires, key)
+	m.bytes -= m.sizes[key]
+	delete(m.sizes, key)
+}
+
+func (m *PolicyCache) Close() error {
+	return nil
+}
+
+// LRUPolicy 最近最少使用, 与 LRUCache 行为一致
+type LRUPolicy struct {
+	capacity int
+	eleList  *list.List
+	eleIndex map[string]*list.Element
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{
+		eleList:  list.New(),
+		eleIndex: make(map[string]*list.Element),
+	}
+}
+
+func (p *LRUPolicy) SetCapacity(capacity int) {
+	p.capacity = capacity
+}
+
+func (p *LRUPolicy) Access(key string) {
+	if ele, ok := p.eleIndex[key]; ok {
+		p.eleList.MoveToBack(ele)
+	}
+}
+
+func (p *LRUPolicy) Add(key string) ([]string, bool) {
+	if ele, ok := p.eleIndex[key]; ok {
+		p.eleList.MoveToBack(ele)
+		return nil, true
+	}
+	p.eleIndex[key] = p.eleList.PushBack(key)
+	var evicted []string
+	for p.capacity > 0 && p.eleList.Len() > p.capacity {
+		evicted = append(evicted, p.removeElement(p.eleList.Front()))
+	}
+	return evicted, true
+}
+
+func (p *LRUPolicy) Remove(key string) {
+	if ele, ok := p.eleIndex[key]; ok {
+		p.removeElement(ele)
+	}
+}
+
+func (p *LRUPolicy) removeElement(ele *list.Element) string {
+	key := ele.Value.(string)
+	p.eleList.Remove(ele)
+	delete(p.eleIndex, key)
+	return key
+}
+
+func (p *LRUPolicy) Len() int {
+	return p.eleList.Len()
+}
+
+// LFUPolicy 最不经常使用, 访问次数相同时淘汰最久未访问的, O(1)
+type LFUPolicy struct {
+	capacity int
+	minFreq  int
+	freqs    map[int]*list.List
+	items    map[string]*list.Element
+}
+
+type lfuItem struct {
+	key  string
+	freq int
+}
+
+func NewLFUPolicy() *LFUPolicy {
+	return &LFUPolicy{
+		freqs: make(map[int]*list.List),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (p *LFUPolicy) SetCapacity(capacity int) {
+	p.capacity = capacity
+}
+
+func (p *LFUPolicy) Access(key string) {
+	ele, ok := p.items[key]
+	if !ok {
+		return
+	}
+	item := ele.Value.(*lfuItem)
+	p.unlink(ele)
+	if item.freq == p.minFreq && p.freqs[item.freq] == nil {
+		p.minFreq++
+	}
+	item.freq++
+	p.items[key] = p.bucket(item.freq).PushBack(item)
+}
+
+func (p *LFUPolicy) Add(key string) ([]string, bool) {
+	if _, ok := p.items[key]; ok {
+		p.Access(key)
+		return nil, true
+	}
+	var evicted []string
+	for p.capacity > 0 && len(p.items) >= p.capacity {
+		evicted = append(evicted, p.evict())
+	}
+	item := &lfuItem{key: key, freq: 1}
+	p.items[key] = p.bucket(1).PushBack(item)
+	p.minFreq = 1
+	return evicted, true
+}
+
+func (p *LFUPolicy) Remove(key string) {
+	if ele, ok := p.items[key]; ok {
+		p.unlink(ele)
+		delete(p.items, key)
+	}
+}
+
+func (p *LFUPolicy) Len() int {
+	return len(p.items)
+}
+
+func (p *LFUPolicy) evict() string {
+	for p.freqs[p.minFreq] == nil {
+		p.minFreq++
+	}
+	ele := p.freqs[p.minFreq].Front()
+	item := ele.Value.(*lfuItem)
+	p.unlink(ele)
+	delete(p.items, item.key)
+	return item.key
+}
+
+func (p *LFUPolicy) bucket(freq int) *list.List {
+	l, ok := p.freqs[freq]
+	if !ok {
+		l = list.New()
+		p.freqs[freq] = l
+	}
+	return l
+}
+
+// unlink 从频次链表移除, 空链表删除
+func (p *LFUPolicy) unlink(ele *list.Element) {
+	freq := ele.Value.(*lfuItem).freq
+	l := p.freqs[freq]
+	l.Remove(ele)
+	if l.Len() == 0 {
+		delete(p.freqs, freq)
+	}
+}
+
+// TinyLFUPolicy W-TinyLFU
+// 新 key 先进入 1% 的窗口 LRU, 窗口淘汰的 key 与主区(SLRU)的淘汰候选比较访问频次, 频次高的留下
+// 访问频次由 Count-Min Sketch 估算, 定期减半老化, 可以抵抗一次性的全量扫描冲刷热点数据
+type TinyLFUPolicy struct {
+	capacity  int
+	window    *lruSegment
+	probation *lruSegment
+	protected *lruSegment
+	sketch    *cmSketch
+}
+
+func NewTinyLFUPolicy() *TinyLFUPolicy {
+	return &TinyLFUPolicy{}
+}
+
+func (p *TinyLFUPolicy) SetCapacity(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	p.capacity = capacity
+	windowCap := capacity / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	mainCap := capacity - windowCap
+	protectedCap := mainCap * 8 / 10
+	p.window = newLRUSegment(windowCap)
+	p.probation = newLRUSegment(mainCap - protectedCap)
+	p.protected = newLRUSegment(protectedCap)
+	p.sketch = newCMSketch(capacity)
+}
+
+func (p *TinyLFUPolicy) Access(key string) {
+	p.sketch.Increment(key)
+	if ele, ok := p.window.index[key]; ok {
+		p.window.list.MoveToBack(ele)
+		return
+	}
+	if ele, ok := p.protected.index[key]; ok {
+		p.protected.list.MoveToBack(ele)
+		return
+	}
+	if _, ok := p.probation.index[key]; ok {
+		// probation 再次访问晋升到 protected, protected 满了降级到 probation
+		p.probation.remove(key)
+		p.protected.push(key)
+		if p.protected.full() {
+			p.probation.push(p.protected.pop())
+		}
+	}
+}
+
+func (p *TinyLFUPolicy) Add(key string) ([]string, bool) {
+	if p.contains(key) {
+		p.Access(key)
+		return nil, true
+	}
+	p.sketch.Increment(key)
+	p.window.push(key)
+	if !p.window.full() {
+		return nil, true
+	}
+	candidate := p.window.pop()
+	if p.probation.Len()+p.protected.Len() < p.probation.capacity+p.protected.capacity {
+		p.probation.push(candidate)
+		return nil, true
+	}
+	// 主区满了, 候选与 probation 最久未访问的比较
+	victim := p.probation.front()
+	if victim == "" {
+		victim = p.protected.front()
+		if p.sketch.Estimate(candidate) > p.sketch.Estimate(victim) {
+			p.protected.remove(victim)
+			p.probation.push(candidate)
+			return []string{victim}, true
+		}
+		return []string{candidate}, candidate != key
+	}
+	if p.sketch.Estimate(candidate) > p.sketch.Estimate(victim) {
+		p.probation.remove(victim)
+		p.probation.push(candidate)
+		return []string{victim}, true
+	}
+	return []string{candidate}, candidate != key
+}
+
+func (p *TinyLFUPolicy) contains(key string) bool {
+	_, w := p.window.index[key]
+	_, pb := p.probation.index[key]
+	_, pt := p.protected.index[key]
+	return w || pb || pt
+}
+
+func (p *TinyLFUPolicy) Remove(key string) {
+	p.window.remove(key)
+	p.probation.remove(key)
+	p.protected.remove(key)
+}
+
+func (p *TinyLFUPolicy) Len() int {
+	return p.window.Len() + p.probation.Len() + p.protected.Len()
+}
+
+// lruSegment W-TinyLFU 分区
+type lruSegment struct {
+	capacity int
+	list     *list.List
+	index    map[string]*list.Element
+}
+
+func newLRUSegment(capacity int) *lruSegment {
+	return &lruSegment{
+		capacity: capacity,
+		list:     list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+func (s *lruSegment) push(key string) {
+	s.index[key] = s.list.PushBack(key)
+}
+
+// pop 移除最久未访问的
+func (s *lruSegment) pop() string {
+	ele := s.list.Front()
+	if ele == nil {
+		return ""
+	}
+	key := ele.Value.(string)
+	s.list.Remove(ele)
+	delete(s.index, key)
+	return key
+}
+
+func (s *lruSegment) front() string {
+	if ele := s.list.Front(); ele != nil {
+		return ele.Value.(string)
+	}
+	return ""
+}
+
+func (s *lruSegment) remove(key string) {
+	if ele, ok := s.index[key]; ok {
+		s.list.Remove(ele)
+		delete(s.index, key)
+	}
+}
+
+func (s *lruSegment) full() bool {
+	return s.list.Len() > s.capacity
+}
+
+func (s *lruSegment) Len() int {
+	return s.list.Len()
+}
+
+// cmSketch Count-Min Sketch, 4 行, 计数上限 15, 增加次数达到 10 倍容量时全部减半
+type cmSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCMSketch(capacity int) *cmSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &cmSketch{
+		mask:    uint64(width - 1),
+		resetAt: 10 * capacity,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch) hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (s *cmSketch) Increment(key string) {
+	h := s.hash(key)
+	h1, h2 := h&0xffffffff, h>>32
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) Estimate(key string) uint8 {
+	h := s.hash(key)
+	h1, h2 := h&0xffffffff, h>>32
+	min := uint8(15)
+	for i := range s.rows {
+		if v := s.rows[i][(h1+uint64(i)*h2)&s.mask]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
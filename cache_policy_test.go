@@ -0,0 +1,91 @@
+package bkit
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestPolicyCache(t *testing.T) {
+	policies := map[string]func() EvictionPolicy{
+		"LRU":     func() EvictionPolicy { return NewLRUPolicy() },
+		"LFU":     func() EvictionPolicy { return NewLFUPolicy() },
+		"TinyLFU": func() EvictionPolicy { return NewTinyLFUPolicy() },
+	}
+	for name, policy := range policies {
+		c := NewCacheWithPolicy(NewMemoryStore(), 100, policy())
+		for i := 0; i < 1000; i++ {
+			_ = c.Set(strconv.Itoa(i), i)
+		}
+		s := c.Stats()
+		if s.Entries > 100 || s.Entries == 0 {
+			t.Fatalf("%s entries %d", name, s.Entries)
+		}
+		n := 0
+		c.Range(func(key string, value interface{}) bool {
+			if v, _ := c.store.Get(key); v != value {
+				t.Fatalf("%s range value not equal", name)
+			}
+			n++
+			return true
+		})
+		if int64(n) != s.Entries {
+			t.Fatalf("%s range %d entries %d", name, n, s.Entries)
+		}
+		_ = c.Set("del", 1)
+		_ = c.Del("del")
+		if _, err := c.Get("del"); !IsNotFoundErr(err) {
+			t.Fatalf("%s should deleted", name)
+		}
+	}
+}
+
+// hitRatio 未命中时写入
+func hitRatio(c *PolicyCache, keys []string) float64 {
+	for _, k := range keys {
+		if _, err := c.Get(k); err != nil {
+			_ = c.Set(k, k)
+		}
+	}
+	return c.Stats().HitRatio()
+}
+
+func zipfKeys(r *rand.Rand, n int) []string {
+	zipf := rand.NewZipf(r, 1.01, 1, 100000)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return keys
+}
+
+func TestPolicyCache_HitRatio(t *testing.T) {
+	const capacity = 1000
+	// zipf 热点分布
+	zipf := zipfKeys(rand.New(rand.NewSource(1)), 200000)
+	// 热点访问中穿插一次全量扫描
+	scan := zipfKeys(rand.New(rand.NewSource(2)), 100000)
+	for i := 0; i < 20000; i++ {
+		scan = append(scan, "scan_"+strconv.Itoa(i))
+	}
+	scan = append(scan, zipfKeys(rand.New(rand.NewSource(3)), 100000)...)
+
+	ratio := make(map[string][2]float64)
+	for name, policy := range map[string]func() EvictionPolicy{
+		"LRU":     func() EvictionPolicy { return NewLRUPolicy() },
+		"LFU":     func() EvictionPolicy { return NewLFUPolicy() },
+		"TinyLFU": func() EvictionPolicy { return NewTinyLFUPolicy() },
+	} {
+		ratio[name] = [2]float64{
+			hitRatio(NewCacheWithPolicy(NewMemoryStore(), capacity, policy()), zipf),
+			hitRatio(NewCacheWithPolicy(NewMemoryStore(), capacity, policy()), scan),
+		}
+		t.Logf("%-8s zipf hit ratio %.4f scan hit ratio %.4f", name, ratio[name][0], ratio[name][1])
+	}
+	if ratio["TinyLFU"][0] <= ratio["LRU"][0] || ratio["LFU"][0] <= ratio["LRU"][0] {
+		t.Fatalf("zipf hit ratio should better than LRU %v", ratio)
+	}
+	if ratio["TinyLFU"][1] <= ratio["LRU"][1] {
+		t.Fatalf("scan hit ratio should better than LRU %v", ratio)
+	}
+}
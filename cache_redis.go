@@ -0,0 +1,202 @@
+package bkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheCodec 缓存值编解码, 用于需要序列化存储的 Cacher 实现
+type CacheCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+var (
+	_ CacheCodec = GobCacheCodec{}
+	_ CacheCodec = JSONCacheCodec{}
+)
+
+// GobCacheCodec gob 编解码, 解码后保留具体类型, 可直接用于 CacheGetOrSet
+// 自定义类型需要先 gob.Register, 例如 gob.Register(User{})
+type GobCacheCodec struct{}
+
+func (GobCacheCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCacheCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// JSONCacheCodec json 编解码
+// New 返回解码目标的指针, 解码后返回指针指向的值; 为空时解码为 interface{}, 结构体会变成 map[string]interface{}
+type JSONCacheCodec struct {
+	New func() interface{}
+}
+
+func (c JSONCacheCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c JSONCacheCodec) Unmarshal(data []byte) (interface{}, error) {
+	if c.New == nil {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	ptr := c.New()
+	if reflect.TypeOf(ptr).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("JSONCacheCodec New must return a pointer, but got %T", ptr)
+	}
+	if err := json.Unmarshal(data, ptr); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
+}
+
+type RedisCacheConf struct {
+	Prefix    string        // key 前缀, Range 只扫描该前缀下的 key
+	ScanCount int64         // Range SCAN 每批数量, 默认 100
+	Timeout   time.Duration // 单个命令超时, 默认 3s
+	Codec     CacheCodec    // 值编解码, 默认 GobCacheCodec
+}
+
+func (c *RedisCacheConf) Validate() error {
+	if c.ScanCount <= 0 {
+		c.ScanCount = 100
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 3 * time.Second
+	}
+	if c.Codec == nil {
+		c.Codec = GobCacheCodec{}
+	}
+	return nil
+}
+
+var _ Cacher = &RedisCache{}
+
+// RedisCache redis.Client Cacher implement
+type RedisCache struct {
+	cfg    *RedisCacheConf
+	client redis.UniversalClient
+}
+
+// NewRedisCache client 由调用方管理, Close 不会关闭 client
+func NewRedisCache(client redis.UniversalClient, cfg ...*RedisCacheConf) *RedisCache {
+	c := &RedisCacheConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		c = cfg[0]
+	}
+	_ = c.Validate()
+	return &RedisCache{
+		cfg:    c,
+		client: client,
+	}
+}
+
+func (m *RedisCache) key(key string) string {
+	return m.cfg.Prefix + key
+}
+
+func (m *RedisCache) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), m.cfg.Timeout)
+}
+
+func (m *RedisCache) Get(key string) (interface{}, error) {
+	ctx, cancel := m.ctx()
+	defer cancel()
+	byt, err := m.client.Get(ctx, m.key(key)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return m.cfg.Codec.Unmarshal(byt)
+}
+
+func (m *RedisCache) Set(key string, value interface{}) error {
+	return m.SetWithTTL(key, value, -1)
+}
+
+// SetWithTTL ttl <= 0 不过期
+func (m *RedisCache) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	byt, err := m.cfg.Codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	ctx, cancel := m.ctx()
+	defer cancel()
+	return m.client.Set(ctx, m.key(key), byt, ttl).Err()
+}
+
+func (m *RedisCache) Del(key string) error {
+	ctx, cancel := m.ctx()
+	defer cancel()
+	return m.client.Del(ctx, m.key(key)).Err()
+}
+
+// Range 通过 SCAN 游标遍历, 不阻塞 redis, 遍历期间写入的 key 可能重复或遗漏
+func (m *RedisCache) Range(f func(key string, value interface{}) bool) {
+	var cursor uint64
+	match := m.cfg.Prefix + "*"
+	for {
+		ctx, cancel := m.ctx()
+		keys, next, err := m.client.Scan(ctx, cursor, match, m.cfg.ScanCount).Result()
+		if err != nil {
+			cancel()
+			return
+		}
+		var values []interface{}
+		if len(keys) > 0 {
+			values, err = m.client.MGet(ctx, keys...).Result()
+		}
+		cancel()
+		if err != nil {
+			return
+		}
+		for i, k := range keys {
+			s, ok := values[i].(string)
+			if !ok {
+				// 已过期或被删除
+				continue
+			}
+			v, err := m.cfg.Codec.Unmarshal([]byte(s))
+			if err != nil {
+				continue
+			}
+			if !f(k[len(m.cfg.Prefix):], v) {
+				return
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+func (m *RedisCache) Close() error {
+	return nil
+}
@@ -0,0 +1,123 @@
+package bkit
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type redisCacheVal struct {
+	Name string
+	Age  int
+}
+
+func init() {
+	gob.Register(redisCacheVal{})
+}
+
+func newTestRedisCache(t *testing.T, cfg ...*RedisCacheConf) (*RedisCache, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return NewRedisCache(client, cfg...), mr
+}
+
+func TestRedisCache(t *testing.T) {
+	c, mr := newTestRedisCache(t, &RedisCacheConf{Prefix: "test:"})
+
+	if _, err := c.Get("1"); !IsNotFoundErr(err) {
+		t.Fatalf("should not found, got %v", err)
+	}
+	if err := c.Set("1", redisCacheVal{Name: "a", Age: 1}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := c.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(redisCacheVal).Name != "a" {
+		t.Fatal("should equal")
+	}
+	if !mr.Exists("test:1") {
+		t.Fatal("key should with prefix")
+	}
+
+	if err := c.SetWithTTL("2", 2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+	if _, err := c.Get("2"); !IsNotFoundErr(err) {
+		t.Fatalf("should expired, got %v", err)
+	}
+
+	if err := c.Del("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("1"); !IsNotFoundErr(err) {
+		t.Fatalf("should deleted, got %v", err)
+	}
+}
+
+func TestRedisCache_Range(t *testing.T) {
+	c, mr := newTestRedisCache(t, &RedisCacheConf{Prefix: "test:", ScanCount: 10})
+	// other prefix not range
+	mr.Set("other", "1")
+
+	for i := 0; i < 55; i++ {
+		_ = c.Set(fmt.Sprintf("%d", i), i)
+	}
+	keys := make(map[string]int)
+	c.Range(func(key string, value interface{}) bool {
+		keys[key] = value.(int)
+		return true
+	})
+	if len(keys) != 55 {
+		t.Fatalf("range should 55, got %d", len(keys))
+	}
+	if keys["10"] != 10 {
+		t.Fatal("should equal")
+	}
+
+	n := 0
+	c.Range(func(key string, value interface{}) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Fatalf("range should stop at 3, got %d", n)
+	}
+}
+
+func TestRedisCache_CacheGetOrSet(t *testing.T) {
+	codecs := []CacheCodec{
+		GobCacheCodec{},
+		JSONCacheCodec{New: func() interface{} { return &redisCacheVal{} }},
+	}
+	for _, codec := range codecs {
+		c, _ := newTestRedisCache(t, &RedisCacheConf{Codec: codec})
+		fetchCount := 0
+		fetchFn := func(ctx context.Context) (interface{}, error) {
+			fetchCount++
+			return &redisCacheVal{Name: "fetch", Age: 18}, nil
+		}
+		for i := 0; i < 3; i++ {
+			val := redisCacheVal{}
+			if err := CacheGetOrSet(c, context.Background(), "key", &val, fetchFn, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if val.Name != "fetch" || val.Age != 18 {
+				t.Fatalf("%T should equal, got %+v", codec, val)
+			}
+		}
+		if fetchCount != 1 {
+			t.Fatalf("%T fetchFn should call once, got %d", codec, fetchCount)
+		}
+	}
+}
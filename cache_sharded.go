@@ -0,0 +1,293 @@
+package bkit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type ShardedCacheConf struct {
+	Shards     int // 分片数, 向上取2的幂, 默认 32
+	MaxElement int // 最大条目数, 平均分配到每个分片, 默认 10000
+}
+
+func (c *ShardedCacheConf) Validate() error {
+	if c.Shards <= 0 {
+		c.Shards = 32
+	}
+	n := 1
+	for n < c.Shards {
+		n <<= 1
+	}
+	c.Shards = n
+	if c.MaxElement <= 0 {
+		c.MaxElement = 10000
+	}
+	if c.MaxElement < c.Shards {
+		c.MaxElement = c.Shards
+	}
+	return nil
+}
+
+var _ Cacher = &ShardedCache{}
+
+// ShardedCache 分片缓存, key 哈希到独立的分片, 每个分片单独加锁, 单独 LRU 淘汰与过期
+// 适合高并发读写, Range 逐个分片复制后遍历, 不持有全局锁, 回调中可以操作缓存
+type ShardedCache struct {
+	cfg    *ShardedCacheConf
+	shards []*cacheShard
+	mask   uint64
+
+	counter cacheCounter
+	mutex   sync.RWMutex
+	onEvict func(key string, value interface{}, reason EvictReason)
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewShardedCache(cfg ...*ShardedCacheConf) *ShardedCache {
+	c := &ShardedCacheConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		c = cfg[0]
+	}
+	_ = c.Validate()
+	m := &ShardedCache{
+		cfg:    c,
+		shards: make([]*cacheShard, c.Shards),
+		mask:   uint64(c.Shards - 1),
+		done:   make(chan struct{}),
+	}
+	maxElement := c.MaxElement / c.Shards
+	for i := range m.shards {
+		m.shards[i] = &cacheShard{
+			eleList:    list.New(),
+			eleIndex:   make(map[string]*list.Element),
+			maxElement: maxElement,
+		}
+	}
+	m.runGC()
+	return m
+}
+
+// shard fnv-1a 64, 避免 hash.Hash 的内存分配
+func (m *ShardedCache) shard(key string) *cacheShard {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return m.shards[h&m.mask]
+}
+
+func (m *ShardedCache) runGC() {
+	go func() {
+		ticker := time.NewTicker(CacheGCInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.GC()
+			}
+		}
+	}()
+}
+
+// GC 删除所有过期 key, 逐个分片加锁
+func (m *ShardedCache) GC() {
+	for _, s := range m.shards {
+		s.mutex.Lock()
+		evicted := s.delExpiredKey(time.Now().UnixNano())
+		s.mutex.Unlock()
+		m.evicted(evicted)
+	}
+}
+
+// OnEvict 设置淘汰回调, 超出容量淘汰和过期删除时调用, 主动 Del 不调用
+func (m *ShardedCache) OnEvict(fn func(key string, value interface{}, reason EvictReason)) {
+	m.mutex.Lock()
+	m.onEvict = fn
+	m.mutex.Unlock()
+}
+
+// Stats 缓存统计, Bytes 按 cacheEntrySize 估算
+func (m *ShardedCache) Stats() CacheStats {
+	s := m.counter.stats()
+	for _, shard := range m.shards {
+		shard.mutex.Lock()
+		s.Entries += int64(shard.eleList.Len())
+		s.Bytes += shard.bytes
+		shard.mutex.Unlock()
+	}
+	return s
+}
+
+func (m *ShardedCache) evicted(evicted []cacheEvicted) {
+	if len(evicted) == 0 {
+		return
+	}
+	for _, v := range evicted {
+		m.counter.evict(v.reason)
+	}
+	m.mutex.RLock()
+	fn := m.onEvict
+	m.mutex.RUnlock()
+	if fn == nil {
+		return
+	}
+	for _, v := range evicted {
+		fn(v.key, v.value, v.reason)
+	}
+}
+
+func (m *ShardedCache) Get(key string) (interface{}, error) {
+	s := m.shard(key)
+	s.mutex.Lock()
+	v, evicted, ok := s.get(key, time.Now().UnixNano())
+	s.mutex.Unlock()
+	m.evicted(evicted)
+	m.counter.hit(ok)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (m *ShardedCache) Set(key string, value interface{}) error {
+	return m.SetWithTTL(key, value, -1)
+}
+
+func (m *ShardedCache) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	expired := int64(0)
+	if ttl > 0 {
+		expired = time.Now().Add(ttl).UnixNano()
+	}
+	s := m.shard(key)
+	size := cacheEntrySize(key, value)
+	s.mutex.Lock()
+	evicted := s.set(key, value, expired, size)
+	s.mutex.Unlock()
+	m.evicted(evicted)
+	return nil
+}
+
+func (m *ShardedCache) Del(key string) error {
+	s := m.shard(key)
+	s.mutex.Lock()
+	if ele, ok := s.eleIndex[key]; ok {
+		s.eleList.Remove(ele)
+		delete(s.eleIndex, key)
+		s.bytes -= ele.Value.(*shardEntry).size
+	}
+	s.mutex.Unlock()
+	return nil
+}
+
+// Range 逐个分片复制数据后遍历, 遍历期间的写入可能不可见
+func (m *ShardedCache) Range(f func(key string, value interface{}) bool) {
+	for _, s := range m.shards {
+		now := time.Now().UnixNano()
+		s.mutex.Lock()
+		entries := make([]shardEntry, 0, s.eleList.Len())
+		for ele := s.eleList.Front(); ele != nil; ele = ele.Next() {
+			e := ele.Value.(*shardEntry)
+			if !e.Expired(now) {
+				entries = append(entries, *e)
+			}
+		}
+		s.mutex.Unlock()
+
+		for _, e := range entries {
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func (m *ShardedCache) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
+
+type shardEntry struct {
+	key     string
+	value   interface{}
+	expired int64 // UnixNano, 0 不过期
+	size    int64
+}
+
+func (e *shardEntry) Expired(now int64) bool {
+	return e.expired > 0 && now > e.expired
+}
+
+// cacheShard goroutine not safety, 调用方加锁
+type cacheShard struct {
+	mutex      sync.Mutex
+	eleList    *list.List
+	eleIndex   map[string]*list.Element
+	maxElement int
+	bytes      int64
+}
+
+func (s *cacheShard) get(key string, now int64) (interface{}, []cacheEvicted, bool) {
+	ele, ok := s.eleIndex[key]
+	if !ok {
+		return nil, nil, false
+	}
+	e := ele.Value.(*shardEntry)
+	if e.Expired(now) {
+		return nil, []cacheEvicted{s.remove(ele, EvictReasonExpired)}, false
+	}
+	s.eleList.MoveToBack(ele)
+	return e.value, nil, true
+}
+
+func (s *cacheShard) set(key string, value interface{}, expired, size int64) []cacheEvicted {
+	if ele, ok := s.eleIndex[key]; ok {
+		e := ele.Value.(*shardEntry)
+		e.value = value
+		e.expired = expired
+		s.bytes += size - e.size
+		e.size = size
+		s.eleList.MoveToBack(ele)
+		return nil
+	}
+	s.eleIndex[key] = s.eleList.PushBack(&shardEntry{key: key, value: value, expired: expired, size: size})
+	s.bytes += size
+
+	var evicted []cacheEvicted
+	for s.eleList.Len() > s.maxElement {
+		front := s.eleList.Front()
+		reason := EvictReasonCapacity
+		if front.Value.(*shardEntry).Expired(time.Now().UnixNano()) {
+			reason = EvictReasonExpired
+		}
+		evicted = append(evicted, s.remove(front, reason))
+	}
+	return evicted
+}
+
+func (s *cacheShard) delExpiredKey(now int64) []cacheEvicted {
+	var evicted []cacheEvicted
+	for ele := s.eleList.Front(); ele != nil; {
+		next := ele.Next()
+		if ele.Value.(*shardEntry).Expired(now) {
+			evicted = append(evicted, s.remove(ele, EvictReasonExpired))
+		}
+		ele = next
+	}
+	return evicted
+}
+
+func (s *cacheShard) remove(ele *list.Element, reason EvictReason) cacheEvicted {
+	e := ele.Value.(*shardEntry)
+	s.eleList.Remove(ele)
+	delete(s.eleIndex, e.key)
+	s.bytes -= e.size
+	return cacheEvicted{key: e.key, value: e.value, reason: reason}
+}
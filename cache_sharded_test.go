@@ -0,0 +1,105 @@
+package bkit
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedCache(t *testing.T) {
+	m := NewShardedCache(&ShardedCacheConf{Shards: 4, MaxElement: 400})
+	defer m.Close()
+
+	for i := 0; i < 1000; i++ {
+		_ = m.Set(strconv.Itoa(i), i)
+	}
+	s := m.Stats()
+	if s.Entries > 400 || s.Evictions != 1000-s.Entries {
+		t.Fatalf("stats %+v", s)
+	}
+	// 最后写入的不会被淘汰
+	if v, err := m.Get("999"); err != nil || v.(int) != 999 {
+		t.Fatal("should equal")
+	}
+
+	_ = m.SetWithTTL("ttl", 1, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := m.Get("ttl"); !IsNotFoundErr(err) {
+		t.Fatal("should expired")
+	}
+	_ = m.Del("999")
+	if _, err := m.Get("999"); !IsNotFoundErr(err) {
+		t.Fatal("should deleted")
+	}
+
+	// Range 回调中可以操作缓存, 不会死锁
+	c := 0
+	m.Range(func(key string, value interface{}) bool {
+		_ = m.Del(key)
+		c++
+		return true
+	})
+	if c == 0 || m.Stats().Entries != 0 {
+		t.Fatalf("range %d entries %d", c, m.Stats().Entries)
+	}
+}
+
+func TestShardedCache_Concurrent(t *testing.T) {
+	m := NewShardedCache()
+	defer m.Close()
+	wg := sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				_ = m.Set(key, i)
+				_, _ = m.Get(key)
+				if i%10 == 0 {
+					m.Range(func(key string, value interface{}) bool {
+						return false
+					})
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func benchmarkCacher(b *testing.B, c Cacher) {
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		_ = c.Set(keys[i], i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i&(len(keys)-1)]
+			if i%10 == 0 {
+				_ = c.Set(key, i)
+			} else {
+				_, _ = c.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+// go test -bench=BenchmarkCacheParallel -benchmem -cpu=1,8
+func BenchmarkCacheParallel(b *testing.B) {
+	b.Run("LRUCache", func(b *testing.B) {
+		benchmarkCacher(b, NewLRUMemory(10000))
+	})
+	b.Run("LimitMemoryCache", func(b *testing.B) {
+		benchmarkCacher(b, NewLimitMemoryCache(-1))
+	})
+	b.Run("ShardedCache", func(b *testing.B) {
+		c := NewShardedCache(&ShardedCacheConf{MaxElement: 10000})
+		defer c.Close()
+		benchmarkCacher(b, c)
+	})
+}
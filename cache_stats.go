@@ -0,0 +1,166 @@
+package bkit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// EvictReason 缓存淘汰原因
+type EvictReason int
+
+const (
+	EvictReasonCapacity EvictReason = iota + 1 // 超出容量淘汰
+	EvictReasonExpired                         // 过期删除
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictReasonCapacity:
+		return "capacity"
+	case EvictReasonExpired:
+		return "expired"
+	}
+	return fmt.Sprintf("EvictReason(%d)", int(r))
+}
+
+// CacheStats 缓存统计
+type CacheStats struct {
+	Hits        int64 // 命中次数
+	Misses      int64 // 未命中次数
+	Evictions   int64 // 超出容量淘汰次数
+	Expirations int64 // 过期删除次数
+	Entries     int64 // 当前条目数
+	Bytes       int64 // 当前估算占用字节数, 按 key 与 value 的长度估算, 未统计大小的缓存为 0
+}
+
+// CacheSizer 自定义 value 的估算大小, 用于 CacheStats.Bytes, 需要准确统计时实现
+type CacheSizer interface {
+	CacheSize() int
+}
+
+// cacheDefaultValueSize 未实现 CacheSizer 的其他类型按固定大小估算
+const cacheDefaultValueSize = 64
+
+// cacheEntrySize 估算条目大小, 写入时调用, 不做格式化或反射
+func cacheEntrySize(key string, value interface{}) int64 {
+	switch v := value.(type) {
+	case CacheSizer:
+		return int64(len(key) + v.CacheSize())
+	case string:
+		return int64(len(key) + len(v))
+	case []byte:
+		return int64(len(key) + len(v))
+	case nil:
+		return int64(len(key))
+	case bool, int8, uint8:
+		return int64(len(key) + 1)
+	case int16, uint16:
+		return int64(len(key) + 2)
+	case int32, uint32, float32:
+		return int64(len(key) + 4)
+	case int, int64, uint, uint64, uintptr, float64:
+		return int64(len(key) + 8)
+	}
+	return int64(len(key) + cacheDefaultValueSize)
+}
+
+// HitRatio 命中率
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// CacheStater 提供统计信息的缓存
+type CacheStater interface {
+	Stats() CacheStats
+}
+
+// WriteCacheStatsPrometheus 以 Prometheus 文本格式输出缓存统计, caches key 为 label cache 的值
+//
+//	http.HandleFunc("/metrics/cache", func(w http.ResponseWriter, r *http.Request) {
+//		_ = bkit.WriteCacheStatsPrometheus(w, "app", map[string]bkit.CacheStater{"user": userCache})
+//	})
+func WriteCacheStatsPrometheus(w io.Writer, namespace string, caches map[string]CacheStater) error {
+	if namespace == "" {
+		namespace = "bkit"
+	}
+	names := make([]string, 0, len(caches))
+	stats := make(map[string]CacheStats, len(caches))
+	for name, c := range caches {
+		names = append(names, name)
+		stats[name] = c.Stats()
+	}
+	sort.Strings(names)
+
+	metrics := []struct {
+		name string
+		typ  string
+		help string
+		val  func(s CacheStats) int64
+	}{
+		{"cache_hits_total", "counter", "Number of cache hits.", func(s CacheStats) int64 { return s.Hits }},
+		{"cache_misses_total", "counter", "Number of cache misses.", func(s CacheStats) int64 { return s.Misses }},
+		{"cache_evictions_total", "counter", "Number of entries evicted by capacity.", func(s CacheStats) int64 { return s.Evictions }},
+		{"cache_expirations_total", "counter", "Number of expired entries removed.", func(s CacheStats) int64 { return s.Expirations }},
+		{"cache_entries", "gauge", "Current number of entries.", func(s CacheStats) int64 { return s.Entries }},
+		{"cache_bytes", "gauge", "Current estimated size in bytes.", func(s CacheStats) int64 { return s.Bytes }},
+	}
+	for _, m := range metrics {
+		name := namespace + "_" + m.name
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.typ); err != nil {
+			return err
+		}
+		for _, c := range names {
+			if _, err := fmt.Fprintf(w, "%s{cache=%q} %d\n", name, c, m.val(stats[c])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cacheCounter 缓存计数, 并发安全
+type cacheCounter struct {
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+}
+
+func (c *cacheCounter) hit(ok bool) {
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+}
+
+func (c *cacheCounter) evict(reason EvictReason) {
+	switch reason {
+	case EvictReasonCapacity:
+		atomic.AddInt64(&c.evictions, 1)
+	case EvictReasonExpired:
+		atomic.AddInt64(&c.expirations, 1)
+	}
+}
+
+func (c *cacheCounter) stats() CacheStats {
+	return CacheStats{
+		Hits:        atomic.LoadInt64(&c.hits),
+		Misses:      atomic.LoadInt64(&c.misses),
+		Evictions:   atomic.LoadInt64(&c.evictions),
+		Expirations: atomic.LoadInt64(&c.expirations),
+	}
+}
+
+// cacheEvicted 被淘汰的条目, 释放锁后再回调 OnEvict, 回调中可以继续操作缓存
+type cacheEvicted struct {
+	key    string
+	value  interface{}
+	reason EvictReason
+}
@@ -0,0 +1,98 @@
+package bkit
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheStats(t *testing.T) {
+	lru := NewLRUMemory(100)
+	limit := NewLimitMemoryCache(1 << 20)
+
+	mutex := sync.Mutex{}
+	reasons := make(map[EvictReason]int)
+	onEvict := func(key string, value interface{}, reason EvictReason) {
+		mutex.Lock()
+		reasons[reason]++
+		mutex.Unlock()
+	}
+	lru.OnEvict(onEvict)
+	limit.OnEvict(onEvict)
+
+	for i := 0; i < 110; i++ {
+		_ = lru.Set(strconv.Itoa(i), i)
+	}
+	_ = lru.SetWithTTL("ttl", 1, time.Second)
+	_ = limit.Set("109", 1)
+	_ = limit.SetWithTTL("ttl", 1, time.Second)
+
+	time.Sleep(2 * time.Second)
+	for _, c := range []Cacher{lru, limit} {
+		_, _ = c.Get("ttl")
+		_, _ = c.Get("109")
+		_, _ = c.Get("not_found")
+	}
+
+	s := lru.Stats()
+	if s.Hits != 1 || s.Misses != 2 || s.Evictions != 11 || s.Expirations != 1 || s.Entries != 99 {
+		t.Fatalf("lru stats %+v", s)
+	}
+	s = limit.Stats()
+	if s.Hits != 1 || s.Misses != 2 || s.Expirations != 1 || s.Entries != 1 || s.Bytes != 4 {
+		t.Fatalf("limit stats %+v", s)
+	}
+	if reasons[EvictReasonCapacity] != 11 || reasons[EvictReasonExpired] != 2 {
+		t.Fatalf("reasons %v", reasons)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := WriteCacheStatsPrometheus(buf, "", map[string]CacheStater{"lru": lru, "limit": limit}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE bkit_cache_hits_total counter",
+		`bkit_cache_evictions_total{cache="lru"} 11`,
+		`bkit_cache_entries{cache="limit"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("prometheus output should contain %s\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestCacheStatsBytes(t *testing.T) {
+	caches := map[string]interface {
+		Cacher
+		CacheStater
+	}{
+		"lru":     NewLRUMemory(100),
+		"sharded": NewShardedCache(),
+		"policy":  NewCacheWithPolicy(NewMemoryStore(), 100, nil),
+		"limit":   NewLimitMemoryCache(-1),
+	}
+	for name, c := range caches {
+		_ = c.Set("a", "12345")
+		_ = c.Set("b", []byte("12"))
+		_ = c.Set("a", "123")
+		if s := c.Stats(); s.Bytes != 4+3 {
+			t.Fatalf("%s bytes %d", name, s.Bytes)
+		}
+		_ = c.Del("a")
+		_ = c.Del("b")
+		if s := c.Stats(); s.Bytes != 0 {
+			t.Fatalf("%s bytes after del %d", name, s.Bytes)
+		}
+	}
+
+	// 其他类型按固定大小估算
+	if n := cacheEntrySize("k", struct{ A [1024]byte }{}); n != 1+cacheDefaultValueSize {
+		t.Fatalf("unexpected size %d", n)
+	}
+	if n := cacheEntrySize("k", int64(1)); n != 1+8 {
+		t.Fatalf("unexpected size %d", n)
+	}
+}
@@ -0,0 +1,131 @@
+package bkit
+
+import (
+	"sync"
+	"time"
+)
+
+type TieredCacheConf struct {
+	L1TTL time.Duration // L1 最长缓存时间, L2 命中回填 L1 也使用该时间, 默认 1m
+}
+
+func (c *TieredCacheConf) Validate() error {
+	if c.L1TTL <= 0 {
+		c.L1TTL = time.Minute
+	}
+	return nil
+}
+
+var _ Cacher = &TieredCache{}
+
+// TieredCache 二级缓存, L1 一般为本地内存缓存, L2 一般为共享缓存(redis)
+// 读: L1 -> L2, L2 命中回填 L1; 写: 先写 L2 再写 L1
+// 多节点部署时, 通过 OnInvalidate 发布变更, 其他节点收到后调用 Invalidate 删除本地 L1
+type TieredCache struct {
+	cfg *TieredCacheConf
+	l1  Cacher
+	l2  Cacher
+
+	mutex sync.RWMutex
+	hooks []func(key string)
+}
+
+func NewTieredCache(l1, l2 Cacher, cfg ...*TieredCacheConf) *TieredCache {
+	c := &TieredCacheConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		c = cfg[0]
+	}
+	_ = c.Validate()
+	return &TieredCache{
+		cfg:   c,
+		l1:    l1,
+		l2:    l2,
+		hooks: make([]func(key string), 0),
+	}
+}
+
+// L1 本地缓存
+func (m *TieredCache) L1() Cacher {
+	return m.l1
+}
+
+// L2 远程缓存
+func (m *TieredCache) L2() Cacher {
+	return m.l2
+}
+
+func (m *TieredCache) Get(key string) (interface{}, error) {
+	v, err := m.l1.Get(key)
+	if err == nil {
+		return v, nil
+	}
+	v, err = m.l2.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	_ = m.l1.SetWithTTL(key, v, m.cfg.L1TTL)
+	return v, nil
+}
+
+// Range 遍历 L2, L2 为完整数据
+func (m *TieredCache) Range(f func(key string, value interface{}) bool) {
+	m.l2.Range(f)
+}
+
+func (m *TieredCache) Set(key string, value interface{}) error {
+	return m.SetWithTTL(key, value, -1)
+}
+
+// SetWithTTL L1 的 TTL 不超过 L1TTL
+func (m *TieredCache) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if err := m.l2.SetWithTTL(key, value, ttl); err != nil {
+		// L2 写失败, L1 不能保留旧值
+		_ = m.l1.Del(key)
+		return err
+	}
+	l1TTL := m.cfg.L1TTL
+	if ttl > 0 && ttl < l1TTL {
+		l1TTL = ttl
+	}
+	_ = m.l1.SetWithTTL(key, value, l1TTL)
+	m.notify(key)
+	return nil
+}
+
+func (m *TieredCache) Del(key string) error {
+	err := m.l2.Del(key)
+	_ = m.l1.Del(key)
+	if err != nil {
+		return err
+	}
+	m.notify(key)
+	return nil
+}
+
+// Invalidate 只删除本地 L1, 用于接收其他节点的变更通知
+func (m *TieredCache) Invalidate(key string) {
+	_ = m.l1.Del(key)
+}
+
+// OnInvalidate 注册变更回调, Set/Del 成功后调用, 用于通知其他节点删除 L1
+func (m *TieredCache) OnInvalidate(fn func(key string)) {
+	if fn == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.hooks = append(m.hooks, fn)
+	m.mutex.Unlock()
+}
+
+func (m *TieredCache) notify(key string) {
+	m.mutex.RLock()
+	hooks := m.hooks
+	m.mutex.RUnlock()
+	for _, fn := range hooks {
+		fn(key)
+	}
+}
+
+func (m *TieredCache) Close() error {
+	return ErrMulti(m.l1.Close(), m.l2.Close())
+}
@@ -0,0 +1,69 @@
+package bkit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTieredCache(t *testing.T) {
+	l2 := NewLimitMemoryCache(-1)
+	node1 := NewTieredCache(NewLRUMemory(100), l2, &TieredCacheConf{L1TTL: time.Minute})
+	node2 := NewTieredCache(NewLRUMemory(100), l2)
+	// node1 变更通知 node2
+	node1.OnInvalidate(node2.Invalidate)
+
+	if err := node1.Set("1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := node1.L1().Get("1"); err != nil || v.(int) != 1 {
+		t.Fatal("set should write through L1")
+	}
+
+	// node2 read through L2, backfill L1
+	if v, err := node2.Get("1"); err != nil || v.(int) != 1 {
+		t.Fatal("should read from L2")
+	}
+	if _, err := node2.L1().Get("1"); err != nil {
+		t.Fatal("should backfill L1")
+	}
+
+	// node1 update, node2 L1 invalidated
+	if err := node1.Set("1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node2.L1().Get("1"); !IsNotFoundErr(err) {
+		t.Fatal("node2 L1 should invalidated")
+	}
+	if v, _ := node2.Get("1"); v.(int) != 2 {
+		t.Fatal("node2 should get new value")
+	}
+
+	if err := node1.Del("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node2.Get("1"); !IsNotFoundErr(err) {
+		t.Fatalf("should deleted, got %v", err)
+	}
+}
+
+func TestTieredCache_CacheGetOrSet(t *testing.T) {
+	c := NewTieredCache(NewLRUMemory(100), NewLimitMemoryCache(-1))
+	fetchCount := 0
+	for i := 0; i < 3; i++ {
+		var val int
+		err := CacheGetOrSet(c, context.Background(), "key", &val, func(ctx context.Context) (interface{}, error) {
+			fetchCount++
+			return 10, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != 10 {
+			t.Fatal("should equal")
+		}
+	}
+	if fetchCount != 1 {
+		t.Fatalf("fetchFn should call once, got %d", fetchCount)
+	}
+}
@@ -0,0 +1,140 @@
+package bkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrCacheTypeMismatch = errors.New("bkit/caches: value type mismatch")
+
+type TypedCacheConf struct {
+	// LoadTimeout GetOrLoad 并发加载共享的 fn 超时时间, 默认 30s
+	// fn 不跟随单个调用的 ctx 取消, 每个调用按自己的 ctx 返回
+	LoadTimeout time.Duration
+}
+
+func (c *TypedCacheConf) Validate() error {
+	if c.LoadTimeout <= 0 {
+		c.LoadTimeout = 30 * time.Second
+	}
+	return nil
+}
+
+// TypedCache 泛型缓存, 基于任意 Cacher, 调用方不再需要类型断言
+// key 为 prefix + fmt.Sprint(K), 可通过 prefix 区分不同业务的 key
+type TypedCache[K comparable, V any] struct {
+	cfg    *TypedCacheConf
+	c      Cacher
+	prefix string
+	group  singleflight.Group
+}
+
+func NewTypedCache[K comparable, V any](c Cacher, prefix string, cfg ...*TypedCacheConf) *TypedCache[K, V] {
+	conf := &TypedCacheConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &TypedCache[K, V]{
+		cfg:    conf,
+		c:      c,
+		prefix: prefix,
+	}
+}
+
+// Cacher 底层缓存
+func (tc *TypedCache[K, V]) Cacher() Cacher {
+	return tc.c
+}
+
+func (tc *TypedCache[K, V]) key(k K) string {
+	return tc.prefix + fmt.Sprint(k)
+}
+
+// Get 不存在返回 false, 缓存值类型不是 V 返回 ErrCacheTypeMismatch
+func (tc *TypedCache[K, V]) Get(ctx context.Context, k K) (V, bool, error) {
+	var zero V
+	v, err := tc.c.Get(tc.key(k))
+	if err != nil {
+		if IsNotFoundErr(err) {
+			return zero, false, nil
+		}
+		return zero, false, err
+	}
+	val, ok := v.(V)
+	if !ok {
+		return zero, false, fmt.Errorf("%w: key %s want %T got %T", ErrCacheTypeMismatch, tc.key(k), zero, v)
+	}
+	return val, true, nil
+}
+
+// Set ttl 不传则不过期
+func (tc *TypedCache[K, V]) Set(ctx context.Context, k K, v V, ttl ...time.Duration) error {
+	if len(ttl) > 0 {
+		return tc.c.SetWithTTL(tc.key(k), v, ttl[0])
+	}
+	return tc.c.Set(tc.key(k), v)
+}
+
+func (tc *TypedCache[K, V]) Del(ctx context.Context, k K) error {
+	return tc.c.Del(tc.key(k))
+}
+
+// GetOrLoad 不存在或类型不匹配时调用 fn 加载并写入缓存, 同一个 key 的并发加载只调用一次 fn
+func (tc *TypedCache[K, V]) GetOrLoad(ctx context.Context, k K, fn func(ctx context.Context, k K) (V, error), ttl ...time.Duration) (V, error) {
+	v, ok, err := tc.Get(ctx, k)
+	if err != nil && !errors.Is(err, ErrCacheTypeMismatch) {
+		return v, err
+	}
+	if ok {
+		return v, nil
+	}
+	ch := tc.group.DoChan(tc.key(k), func() (interface{}, error) {
+		// 第一个调用取消不影响其他等待的调用
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tc.cfg.LoadTimeout)
+		defer cancel()
+		val, err := fn(loadCtx, k)
+		if err != nil {
+			return val, err
+		}
+		_ = tc.Set(loadCtx, k, val, ttl...)
+		return val, nil
+	})
+	select {
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	case ret := <-ch:
+		val, _ := ret.Val.(V)
+		return val, ret.Err
+	}
+}
+
+// GetMany 批量获取, 返回值只包含存在的 key
+func (tc *TypedCache[K, V]) GetMany(ctx context.Context, ks []K) (map[K]V, error) {
+	out := make(map[K]V, len(ks))
+	for _, k := range ks {
+		v, ok, err := tc.Get(ctx, k)
+		if err != nil {
+			return out, err
+		}
+		if ok {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// SetMany 批量设置
+func (tc *TypedCache[K, V]) SetMany(ctx context.Context, kvs map[K]V, ttl ...time.Duration) error {
+	for k, v := range kvs {
+		if err := tc.Set(ctx, k, v, ttl...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
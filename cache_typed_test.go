@@ -0,0 +1,107 @@
+package bkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTypedCache(t *testing.T) {
+	type user struct {
+		ID   int64
+		Name string
+	}
+	ctx := context.Background()
+	lru := NewLRUMemory(100)
+	users := NewTypedCache[int64, user](lru, "user:")
+	names := NewTypedCache[int64, string](lru, "name:")
+
+	if _, ok, err := users.Get(ctx, 1); ok || err != nil {
+		t.Fatal("should not found")
+	}
+	if err := users.Set(ctx, 1, user{ID: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.Set(ctx, 1, "name_a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	u, ok, err := users.Get(ctx, 1)
+	if err != nil || !ok || u.Name != "a" {
+		t.Fatal("should equal")
+	}
+	if name, _, _ := names.Get(ctx, 1); name != "name_a" {
+		t.Fatal("namespace should isolate")
+	}
+
+	// type mismatch
+	_ = lru.Set("user:2", "not user")
+	if _, _, err := users.Get(ctx, 2); !errors.Is(err, ErrCacheTypeMismatch) {
+		t.Fatalf("should type mismatch, got %v", err)
+	}
+	loadCount := 0
+	load := func(ctx context.Context, id int64) (user, error) {
+		loadCount++
+		return user{ID: id, Name: "load"}, nil
+	}
+	for i := 0; i < 3; i++ {
+		u, err = users.GetOrLoad(ctx, 2, load)
+		if err != nil || u.Name != "load" {
+			t.Fatal("should load")
+		}
+	}
+	if loadCount != 1 {
+		t.Fatalf("load should call once, got %d", loadCount)
+	}
+
+	if err := users.SetMany(ctx, map[int64]user{3: {ID: 3}, 4: {ID: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := users.GetMany(ctx, []int64{1, 3, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[4].ID != 4 {
+		t.Fatalf("GetMany got %v", got)
+	}
+
+	_ = users.Del(ctx, 1)
+	if _, ok, _ := users.Get(ctx, 1); ok {
+		t.Fatal("should deleted")
+	}
+}
+
+func TestTypedCache_FirstCallerCancel(t *testing.T) {
+	users := NewTypedCache[int, string](NewLRUMemory(100), "user:", &TypedCacheConf{LoadTimeout: time.Second})
+	load := func(ctx context.Context, k int) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			return "tom", nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := users.GetOrLoad(ctx, 1, load)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan string, 1)
+	go func() {
+		v, err := users.GetOrLoad(context.Background(), 1, load)
+		if err != nil {
+			v = err.Error()
+		}
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	if v := <-second; v != "tom" {
+		t.Fatalf("waiter should get value, got %s", v)
+	}
+}
@@ -0,0 +1,246 @@
+package bkit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrConcurrencyLimited = fmt.Errorf("concurrency limit exceeded")
+
+const (
+	ConcurrencyFixed    = ""         // 固定并发数
+	ConcurrencyAIMD     = "aimd"     // 耗时超过阈值或请求失败时按比例减小, 否则加 1
+	ConcurrencyGradient = "gradient" // 按长期与短期耗时的比值调整, 参考 Netflix concurrency-limits Gradient2
+)
+
+type ConcurrencyLimiterConf struct {
+	Limit        int           // 初始并发数, 默认 100, 固定模式下即为并发上限
+	MaxQueue     int           // 等待队列长度, 默认 Limit, 小于 0 不排队
+	QueueTimeout time.Duration // 排队超时, 默认 1s
+	Adaptive     string        // 自适应模式, 默认固定
+
+	MinLimit int // 自适应模式的并发下限, 默认 1
+	MaxLimit int // 自适应模式的并发上限, 默认 Limit*10
+
+	// AIMD
+	LatencyThreshold time.Duration // 耗时超过阈值视为过载, 默认 1s
+	BackoffRatio     float64       // 过载时乘以该比例, 默认 0.9
+
+	// Gradient
+	Tolerance float64 // 允许短期耗时超过长期耗时的倍数, 默认 1.5
+	Smoothing float64 // 新值的权重, 默认 0.2
+}
+
+func (c *ConcurrencyLimiterConf) Validate() error {
+	if c.Limit <= 0 {
+		c.Limit = 100
+	}
+	if c.MaxQueue == 0 {
+		c.MaxQueue = c.Limit
+	}
+	if c.QueueTimeout <= 0 {
+		c.QueueTimeout = time.Second
+	}
+	switch c.Adaptive {
+	case ConcurrencyFixed, ConcurrencyAIMD, ConcurrencyGradient:
+	default:
+		return fmt.Errorf("invalid adaptive %s", c.Adaptive)
+	}
+	if c.MinLimit <= 0 {
+		c.MinLimit = 1
+	}
+	if c.MaxLimit < c.Limit {
+		c.MaxLimit = c.Limit * 10
+	}
+	if c.LatencyThreshold <= 0 {
+		c.LatencyThreshold = time.Second
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = 0.9
+	}
+	if c.Tolerance < 1 {
+		c.Tolerance = 1.5
+	}
+	if c.Smoothing <= 0 || c.Smoothing > 1 {
+		c.Smoothing = 0.2
+	}
+	return nil
+}
+
+// ConcurrencyStats 并发限制统计
+type ConcurrencyStats struct {
+	Limit    int   `json:"limit"`
+	InFlight int   `json:"in_flight"`
+	Queued   int   `json:"queued"`
+	Rejected int64 `json:"rejected"`
+}
+
+// ConcurrencyLimiter 限制同时执行的请求数, 超出时进入有界 FIFO 队列等待
+// 自适应模式根据请求耗时调整上限, 下游变慢时减少并发, 多余请求快速失败
+type ConcurrencyLimiter struct {
+	cfg *ConcurrencyLimiterConf
+
+	mutex    sync.Mutex
+	limit    float64
+	inflight int
+	queue    *list.List // *concurrencyWaiter
+	rejected int64
+
+	// gradient 的长期与短期耗时, 纳秒
+	longRtt  float64
+	shortRtt float64
+}
+
+type concurrencyWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func NewConcurrencyLimiter(cfg ...*ConcurrencyLimiterConf) *ConcurrencyLimiter {
+	conf := &ConcurrencyLimiterConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	if err := conf.Validate(); err != nil {
+		panic(err)
+	}
+	return &ConcurrencyLimiter{
+		cfg:   conf,
+		limit: float64(conf.Limit),
+		queue: list.New(),
+	}
+}
+
+func (l *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return ConcurrencyStats{
+		Limit:    int(l.limit),
+		InFlight: l.inflight,
+		Queued:   l.queue.Len(),
+		Rejected: atomic.LoadInt64(&l.rejected),
+	}
+}
+
+// Acquire 获取执行位置, 队列已满, 排队超时返回 ErrConcurrencyLimited, ctx 结束返回 ctx.Err()
+// 成功时返回 release, 请求结束时调用, dropped 表示请求因过载失败, 例如下游超时
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) (func(dropped bool), error) {
+	l.mutex.Lock()
+	if l.inflight < int(l.limit) && l.queue.Len() == 0 {
+		l.inflight++
+		inflight := l.inflight
+		l.mutex.Unlock()
+		return l.releaser(time.Now(), inflight), nil
+	}
+	if l.queue.Len() >= l.cfg.MaxQueue {
+		l.mutex.Unlock()
+		atomic.AddInt64(&l.rejected, 1)
+		return nil, ErrConcurrencyLimited
+	}
+	w := &concurrencyWaiter{ready: make(chan struct{})}
+	elem := l.queue.PushBack(w)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		err = ErrConcurrencyLimited
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		l.mutex.Lock()
+		if !w.granted {
+			l.queue.Remove(elem)
+			l.mutex.Unlock()
+			atomic.AddInt64(&l.rejected, 1)
+			return nil, err
+		}
+		// 超时的同时已被唤醒, 按获取成功处理
+		l.mutex.Unlock()
+	}
+	l.mutex.Lock()
+	inflight := l.inflight
+	l.mutex.Unlock()
+	return l.releaser(time.Now(), inflight), nil
+}
+
+func (l *ConcurrencyLimiter) releaser(start time.Time, inflight int) func(dropped bool) {
+	var once sync.Once
+	return func(dropped bool) {
+		once.Do(func() {
+			l.release(time.Since(start), inflight, dropped)
+		})
+	}
+}
+
+func (l *ConcurrencyLimiter) release(rtt time.Duration, inflight int, dropped bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inflight--
+	switch l.cfg.Adaptive {
+	case ConcurrencyAIMD:
+		l.aimd(rtt, inflight, dropped)
+	case ConcurrencyGradient:
+		l.gradient(rtt, inflight, dropped)
+	}
+	// 按 FIFO 唤醒等待者, 直接转交位置
+	for l.inflight < int(l.limit) && l.queue.Len() > 0 {
+		w := l.queue.Remove(l.queue.Front()).(*concurrencyWaiter)
+		w.granted = true
+		l.inflight++
+		close(w.ready)
+	}
+}
+
+func (l *ConcurrencyLimiter) setLimit(v float64) {
+	l.limit = math.Max(float64(l.cfg.MinLimit), math.Min(float64(l.cfg.MaxLimit), v))
+}
+
+// aimd 过载时乘性减小, 并发接近上限且正常时加性增大
+func (l *ConcurrencyLimiter) aimd(rtt time.Duration, inflight int, dropped bool) {
+	if dropped || rtt > l.cfg.LatencyThreshold {
+		l.setLimit(l.limit * l.cfg.BackoffRatio)
+		return
+	}
+	if float64(inflight)*2 >= l.limit {
+		l.setLimit(l.limit + 1)
+	}
+}
+
+// gradient 长期耗时作为基线, 短期耗时明显变大时按比值减小, 排队余量为 sqrt(limit)
+func (l *ConcurrencyLimiter) gradient(rtt time.Duration, inflight int, dropped bool) {
+	sample := float64(rtt)
+	if dropped {
+		// 失败的请求耗时不可信, 视为过载
+		sample = math.Max(sample, l.shortRtt*2)
+	}
+	if l.longRtt == 0 {
+		l.longRtt, l.shortRtt = sample, sample
+		return
+	}
+	l.shortRtt = l.shortRtt*0.9 + sample*0.1
+	l.longRtt = l.longRtt*0.99 + sample*0.01
+	if l.shortRtt <= 0 {
+		return
+	}
+	// 耗时长期下降后基线跟随回落
+	if l.longRtt/l.shortRtt > 2 {
+		l.longRtt *= 0.95
+	}
+	// 并发未用满时耗时不能反映容量
+	if float64(inflight) < l.limit/2 && !dropped {
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, l.cfg.Tolerance*l.longRtt/l.shortRtt))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-l.cfg.Smoothing) + next*l.cfg.Smoothing)
+}
@@ -0,0 +1,147 @@
+package bkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	l := NewConcurrencyLimiter(&ConcurrencyLimiterConf{Limit: 2, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond})
+	r1, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, _ := l.Acquire(context.Background())
+
+	acquired := make(chan func(bool), 1)
+	go func() {
+		r, err := l.Acquire(context.Background())
+		if err == nil {
+			acquired <- r
+		}
+	}()
+	waitFor(t, time.Second, func() bool { return l.Stats().Queued == 1 }, "not queued")
+	if _, err := l.Acquire(context.Background()); err != ErrConcurrencyLimited {
+		t.Fatalf("expect ErrConcurrencyLimited, got %v", err)
+	}
+
+	r1(false)
+	r1(false) // 重复 release 无效
+	r3 := <-acquired
+	if st := l.Stats(); st.InFlight != 2 || st.Queued != 0 || st.Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background()); err != ErrConcurrencyLimited || time.Since(start) < 40*time.Millisecond {
+		t.Fatalf("expect queue timeout, got %v", err)
+	}
+	r2(false)
+	r3(false)
+	if st := l.Stats(); st.InFlight != 0 || st.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	aimd := NewConcurrencyLimiter(&ConcurrencyLimiterConf{Limit: 10, Adaptive: ConcurrencyAIMD, LatencyThreshold: 10 * time.Millisecond})
+	aimd.release(time.Millisecond, 8, false)
+	if st := aimd.Stats(); st.Limit != 11 {
+		t.Fatalf("expect additive increase, got %+v", st)
+	}
+	aimd.release(time.Millisecond, 8, true)
+	aimd.release(20*time.Millisecond, 8, false)
+	if st := aimd.Stats(); st.Limit != 8 {
+		t.Fatalf("expect multiplicative decrease, got %+v", st)
+	}
+
+	gradient := NewConcurrencyLimiter(&ConcurrencyLimiterConf{Limit: 20, Adaptive: ConcurrencyGradient})
+	for i := 0; i < 50; i++ {
+		gradient.release(time.Millisecond, 20, false)
+	}
+	grown := gradient.Stats().Limit
+	if grown <= 20 {
+		t.Fatalf("expect limit grow, got %d", grown)
+	}
+	for i := 0; i < 50; i++ {
+		gradient.release(20*time.Millisecond, grown, false)
+	}
+	if st := gradient.Stats(); st.Limit >= grown {
+		t.Fatalf("expect limit shrink from %d, got %+v", grown, st)
+	}
+}
+
+func TestMidConcurrencyLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewConcurrencyLimiter(&ConcurrencyLimiterConf{Limit: 1, MaxQueue: -1})
+	engine := gin.New()
+	block := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	api := engine.Group("/api", Gin.MidConcurrencyLimiter(l))
+	api.GET("/slow", func(c *gin.Context) {
+		entered <- struct{}{}
+		<-block
+		c.String(http.StatusOK, "ok")
+	})
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/slow", nil))
+	}()
+	<-entered
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/slow", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect 429, got %d", rec.Code)
+	}
+	close(block)
+	wg.Wait()
+	if st := l.Stats(); st.InFlight != 0 || st.Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	engine = DefaultGinEngine(GinMConcurrency)
+	engine.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if rec.Code != http.StatusOK || Gin.ConcurrencyLimiter().Stats().InFlight != 0 {
+		t.Fatalf("unexpected code %d", rec.Code)
+	}
+}
+
+func TestMidConcurrencyLimiter_Panic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewConcurrencyLimiter(&ConcurrencyLimiterConf{Limit: 10, Adaptive: ConcurrencyAIMD})
+	engine := gin.New()
+	engine.Use(Gin.MidConcurrencyLimiter(l), Gin.MidRecoveryLogger())
+	engine.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expect 500, got %d", rec.Code)
+	}
+
+	// Recovery 在外层
+	engine = gin.New()
+	engine.Use(Gin.MidRecoveryLogger(), Gin.MidConcurrencyLimiter(l))
+	engine.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if st := l.Stats(); st.InFlight != 0 || st.Limit != 8 {
+		t.Fatalf("panic should count as dropped, stats %+v", st)
+	}
+}
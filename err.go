@@ -50,6 +50,9 @@ const (
 
 	// 资源相关-内部定义
 	ErrCodeNotFound ErrCode = 404
+
+	// 限流相关-内部定义
+	ErrCodeTooManyRequests ErrCode = 429
 )
 
 var ErrMsgLang = "CN"
@@ -65,6 +68,8 @@ var ErrMsgCN = map[ErrCode]string{
 	ErrCodeAuthInvalid:  "权限无效",
 	ErrCodeParamInvalid: "参数验证无效",
 	ErrCodeNotFound:     "资源不存在",
+
+	ErrCodeTooManyRequests: "请求过于频繁",
 }
 
 var ErrMsg = map[ErrCode]string{
@@ -74,6 +79,8 @@ var ErrMsg = map[ErrCode]string{
 	ErrCodeAuthInvalid:  "auth invalid",
 	ErrCodeParamInvalid: "param invalid",
 	ErrCodeNotFound:     "not found",
+
+	ErrCodeTooManyRequests: "too many requests",
 }
 
 func GetErrMsg(code ErrCode) string {
@@ -91,6 +98,8 @@ var (
 	ErrAuthInvalid  = NewErr(ErrCodeAuthInvalid, GetErrMsg(ErrCodeAuthInvalid))
 	ErrParamInvalid = NewErr(ErrCodeParamInvalid, GetErrMsg(ErrCodeParamInvalid))
 	ErrNotFound     = NewErr(ErrCodeNotFound, GetErrMsg(ErrCodeNotFound))
+
+	ErrTooManyRequests = NewErr(ErrCodeTooManyRequests, GetErrMsg(ErrCodeTooManyRequests))
 )
 
 type Err struct {
@@ -0,0 +1,54 @@
+package bkit
+
+import (
+	"fmt"
+	"regexp"
+
+	"gorm.io/gorm"
+)
+
+// ErrFencingTokenStale 写入携带的 fencing token 比存储中已见过的小, 锁已经被其他持有者获取
+var ErrFencingTokenStale = fmt.Errorf("fencing token stale")
+
+var fencingColumnRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// GormFencingScope 只更新 column <= token 的记录, 同时需要把 column 更新为 token
+// column 只能是字段名或 表名.字段名, 否则返回错误
+//
+//	db.Model(&Order{}).Where("id = ?", id).Scopes(GormFencingScope("fence_token", lock.Token())).
+//		Updates(map[string]interface{}{"status": 2, "fence_token": lock.Token()})
+func GormFencingScope(column string, token int64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !fencingColumnRegexp.MatchString(column) {
+			_ = db.AddError(fmt.Errorf("invalid fencing column %q", column))
+			return db
+		}
+		quoted := db.Statement.Quote(column)
+		return db.Where(fmt.Sprintf("(%s IS NULL OR %s <= ?)", quoted, quoted), token)
+	}
+}
+
+// GormFencingCheck 检查 GormFencingScope 更新结果, 未更新任何记录时返回 ErrFencingTokenStale
+// 记录不存在同样返回 ErrFencingTokenStale
+func GormFencingCheck(tx *gorm.DB) error {
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected > 0 {
+		return nil
+	}
+	// MySQL 未开启 clientFoundRows 时, 当前持有者重复写入相同的值 RowsAffected 也为 0, 按相同条件再确认一次
+	where, ok := tx.Statement.Clauses["WHERE"]
+	if !ok || tx.Statement.Table == "" {
+		return ErrFencingTokenStale
+	}
+	var n int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Table(tx.Statement.Table).
+		Clauses(where.Expression).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrFencingTokenStale
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package bkit
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type fencingOrder struct {
+	ID         int64
+	Status     int
+	FenceToken int64
+}
+
+func TestGormFencingScope(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "root:123456@tcp(127.0.0.1:3306)/test_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := db.Model(&fencingOrder{}).Where("id = ?", 1).Scopes(GormFencingScope("fence_token", 5)).
+		Updates(map[string]interface{}{"status": 2, "fence_token": 5})
+	sql := tx.Statement.SQL.String()
+	if !strings.Contains(sql, "(`fence_token` IS NULL OR `fence_token` <= ?)") {
+		t.Fatalf("sql %s %v", sql, tx.Error)
+	}
+	if err := GormFencingCheck(tx); err != ErrFencingTokenStale {
+		t.Fatalf("dry run should stale, got %v", err)
+	}
+
+	tx = db.Model(&fencingOrder{}).Scopes(GormFencingScope("fence_token = 0 OR 1", 5)).Updates(map[string]interface{}{"status": 2})
+	if tx.Error == nil {
+		t.Fatal("invalid column should error")
+	}
+}
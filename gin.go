@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	sfiles "github.com/swaggo/files"
@@ -27,6 +28,9 @@ func init() {
 
 type GinUtil struct {
 	skipPaths []string
+
+	concurrency     *ConcurrencyLimiter
+	concurrencyOnce sync.Once
 }
 
 func NewGinUtil() *GinUtil {
@@ -156,20 +160,25 @@ func (g *GinUtil) CloudRespData(c *gin.Context, data interface{}, status ...int)
 	g.CloudResp(c, g.httpStatus(status...), data, nil)
 }
 
-// MidAPILimiter 中间件-接口限流
-func (g *GinUtil) MidAPILimiter(path, method string, r, b int, isWait bool) gin.HandlerFunc {
-	Limiter.Register(fmt.Sprintf("%s_%s", path, strings.ToUpper(method)), r, b)
+// MidAPILimiter 中间件-接口限流, path 为路由模板, 例如 /user/:id, 按 c.FullPath() 匹配
+// limiter 默认进程内的 Limiter, 多副本共享配额使用 RedisRateLimiter
+func (g *GinUtil) MidAPILimiter(path, method string, r, b int, isWait bool, limiter ...RateLimiter) gin.HandlerFunc {
+	var lim RateLimiter = Limiter
+	if len(limiter) > 0 && limiter[0] != nil {
+		lim = limiter[0]
+	}
+	lim.Register(fmt.Sprintf("%s_%s", path, strings.ToUpper(method)), r, b)
 
 	return func(c *gin.Context) {
-		key := fmt.Sprintf("%s_%s", c.Request.URL.Path, c.Request.Method)
+		key := fmt.Sprintf("%s_%s", routePath(c), c.Request.Method)
 		if isWait {
-			if err := Limiter.Wait(c, key); err != nil {
+			if err := lim.Wait(c, key); err != nil {
 				c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
 				c.Abort()
 				return
 			}
 		} else {
-			if !Limiter.Allow(key) {
+			if !lim.Allow(key) {
 				c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
 				c.Abort()
 				return
@@ -262,6 +271,7 @@ const (
 	GinMDumpBody      // Dump req | resp body
 	GinMRecoverLogger // Recover logging
 	GinMPprof         // http pprof
+	GinMConcurrency   // adaptive concurrency limit, see SetConcurrencyLimiter
 
 	GinMStd = GinMSwagger | GinMDumpBody // default
 )
@@ -316,6 +326,10 @@ func DefaultGinEngine(flags int, middleware ...gin.HandlerFunc) *gin.Engine {
 	if flags&GinMRecoverLogger != 0 {
 		engine.Use(Gin.MidRecoveryLogger())
 	}
+	// 在 Recovery 内层, panic 按过载计数
+	if flags&GinMConcurrency != 0 {
+		engine.Use(Gin.MidConcurrencyLimiter(Gin.ConcurrencyLimiter(), Gin.skipPaths...))
+	}
 
 	if flags&GinMPprof != 0 {
 		Gin.pprofHandler(engine)
@@ -0,0 +1,205 @@
+package bkit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// LimiterKeyFunc 从请求中提取限流的客户端标识, 返回空时不限流
+type LimiterKeyFunc func(c *gin.Context) string
+
+// LimiterKeyIP 按客户端 IP 限流
+func LimiterKeyIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// LimiterKeyHeader 按请求头限流, 例如 API key
+func LimiterKeyHeader(name string) LimiterKeyFunc {
+	return func(c *gin.Context) string {
+		return c.GetHeader(name)
+	}
+}
+
+// LimiterKeyContext 按 gin.Context 中的值限流, 例如鉴权中间件设置的用户 ID 或租户 ID
+func LimiterKeyContext(key string) LimiterKeyFunc {
+	return func(c *gin.Context) string {
+		v, ok := c.Get(key)
+		if !ok || v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+type ClientLimiterConf struct {
+	Rate    int            // 每个客户端每秒请求数
+	Burst   int            // 桶的容量, 默认 Rate
+	Key     LimiterKeyFunc // 客户端标识, 默认 LimiterKeyIP
+	Scope   string         // 配额范围, 默认按路由 FullPath 与 Method 分别计数, 设置后使用该中间件的路由共享配额
+	Limiter RateLimitTaker // 默认进程内 MemoryRateLimiter, 多副本共享配额使用 RedisRateLimiter
+	// FailClosed Take 出错时返回 429, 默认放行; Limiter 实现 FailClosed() bool 且为 true 时同样拒绝, 例如 RedisRateLimiterConf.FailClosed
+	FailClosed bool
+}
+
+func (c *ClientLimiterConf) Validate() error {
+	if c.Rate <= 0 {
+		return fmt.Errorf("rate required")
+	}
+	if c.Burst <= 0 {
+		c.Burst = c.Rate
+	}
+	if c.Key == nil {
+		c.Key = LimiterKeyIP
+	}
+	if c.Limiter == nil {
+		c.Limiter = NewMemoryRateLimiter(0)
+	}
+	if v, ok := c.Limiter.(interface{ FailClosed() bool }); ok && v.FailClosed() {
+		c.FailClosed = true
+	}
+	return nil
+}
+
+// MidClientLimiter 中间件-按客户端限流
+// 响应带 RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset 头, 拒绝时带 Retry-After 并通过 RespErr 返回 429
+func (g *GinUtil) MidClientLimiter(cfg *ClientLimiterConf) gin.HandlerFunc {
+	conf := *cfg
+	if err := conf.Validate(); err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		client := conf.Key(c)
+		if client == "" {
+			c.Next()
+			return
+		}
+		scope := conf.Scope
+		if scope == "" {
+			scope = fmt.Sprintf("%s_%s", routePath(c), c.Request.Method)
+		}
+		res, err := conf.Limiter.Take(c, scope+"|"+client, conf.Rate, conf.Burst)
+		if err != nil {
+			log.Printf("WARNING: client limiter %s %s\n", scope, err.Error())
+			if conf.FailClosed {
+				g.rejectTooManyRequests(c, 0)
+				return
+			}
+			c.Next()
+			return
+		}
+		g.rateLimitHeaders(c, res)
+		if !res.Allowed {
+			g.rejectTooManyRequests(c, res.RetryAfter)
+			return
+		}
+		c.Next()
+	}
+}
+
+// routePath 路由模板, 未匹配到路由时为请求路径
+func routePath(c *gin.Context) string {
+	if p := c.FullPath(); p != "" {
+		return p
+	}
+	return c.Request.URL.Path
+}
+
+func (g *GinUtil) rateLimitHeaders(c *gin.Context, res RateLimitResult) {
+	c.Header(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+	c.Header(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+	c.Header(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(res.ResetAfter)))
+}
+
+// rejectTooManyRequests 429, retryAfter 大于 0 时带 Retry-After 头
+func (g *GinUtil) rejectTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		c.Header(HeaderRetryAfter, strconv.Itoa(ceilSeconds(retryAfter)))
+	}
+	g.RespErr(c, ErrTooManyRequests, http.StatusTooManyRequests)
+	c.Abort()
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MidRouteLimiter 中间件-按配置的限流表限流, 按 c.FullPath() 与 Method 匹配, 未配置的路由不限流
+// 需要在路由注册前 Use, 限流表通过 RouteLimiter.Load 或 WatchConfig 更新
+func (g *GinUtil) MidRouteLimiter(limiter *RouteLimiter, isWait bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			c.Next()
+			return
+		}
+		if isWait {
+			if err := limiter.Wait(c, route, c.Request.Method); err != nil {
+				g.RespErr(c, ErrTooManyRequests.MsgMulti(err.Error()), http.StatusTooManyRequests)
+				c.Abort()
+				return
+			}
+		} else if !limiter.Allow(route, c.Request.Method) {
+			g.rejectTooManyRequests(c, 0)
+			return
+		}
+		c.Next()
+	}
+}
+
+// SetConcurrencyLimiter 设置 GinMConcurrency 使用的并发限制, 需在 DefaultGinEngine 之前调用
+func (g *GinUtil) SetConcurrencyLimiter(limiter *ConcurrencyLimiter) {
+	g.concurrency = limiter
+}
+
+// ConcurrencyLimiter GinMConcurrency 使用的并发限制, 未设置时为 gradient 自适应模式
+func (g *GinUtil) ConcurrencyLimiter() *ConcurrencyLimiter {
+	g.concurrencyOnce.Do(func() {
+		if g.concurrency == nil {
+			g.concurrency = NewConcurrencyLimiter(&ConcurrencyLimiterConf{Adaptive: ConcurrencyGradient})
+		}
+	})
+	return g.concurrency
+}
+
+// MidConcurrencyLimiter 中间件-并发限制, 每个 limiter 独立计数, 按路由组使用不同的 limiter
+// 超出并发且排队失败时通过 RespErr 返回 429, 5xx 响应与 panic 视为过载, skipPaths 按前缀跳过
+func (g *GinUtil) MidConcurrencyLimiter(limiter *ConcurrencyLimiter, skipPaths ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, v := range skipPaths {
+			if strings.HasPrefix(path, v) {
+				c.Next()
+				return
+			}
+		}
+		release, err := limiter.Acquire(c.Request.Context())
+		if err != nil {
+			g.rejectTooManyRequests(c, 0)
+			return
+		}
+		// panic 时 Recovery 可能在外层, 此时还未写入 500, 按过载计数
+		panicked := true
+		defer func() {
+			release(panicked || c.Writer.Status() >= http.StatusInternalServerError)
+		}()
+		c.Next()
+		panicked = false
+	}
+}
@@ -0,0 +1,131 @@
+package bkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	lim := NewMemoryRateLimiter(20 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		res, _ := lim.Take(context.Background(), "a", 10, 2)
+		if !res.Allowed || res.Remaining != 1-i || res.Limit != 2 {
+			t.Fatalf("unexpected result %+v", res)
+		}
+	}
+	res, _ := lim.Take(context.Background(), "a", 10, 2)
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	// 空闲且桶已恢复满时回收, 未恢复满时保留
+	lim = NewMemoryRateLimiter(20 * time.Millisecond)
+	_, _ = lim.Take(context.Background(), "fast", 1000, 1)
+	_, _ = lim.Take(context.Background(), "slow", 1, 1)
+	time.Sleep(30 * time.Millisecond)
+	_, _ = lim.Take(context.Background(), "probe", 1000, 1)
+	if lim.Len() != 2 {
+		t.Fatalf("expect 2 keys, got %d", lim.Len())
+	}
+	res, _ = lim.Take(context.Background(), "slow", 1, 1)
+	if res.Allowed {
+		t.Fatal("evicted limiter reset")
+	}
+}
+
+func TestMidClientLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newEngine := func(cfg *ClientLimiterConf) *gin.Engine {
+		engine := gin.New()
+		engine.Use(func(c *gin.Context) {
+			c.Set("uid", c.GetHeader("X-Uid"))
+		})
+		engine.GET("/user/:id", Gin.MidClientLimiter(cfg), func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+		return engine
+	}
+	do := func(engine *gin.Engine, path, uid string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Uid", uid)
+		engine.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for name, limiter := range map[string]RateLimitTaker{
+		"memory": NewMemoryRateLimiter(0),
+		"redis":  newTestRedisRateLimiter(t, miniredis.RunT(t)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			engine := newEngine(&ClientLimiterConf{Rate: 1, Key: LimiterKeyContext("uid"), Limiter: limiter})
+			rec := do(engine, "/user/1", "alice")
+			if rec.Code != http.StatusOK || rec.Header().Get(HeaderRateLimitLimit) != "1" || rec.Header().Get(HeaderRateLimitRemaining) != "0" {
+				t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+			}
+			// 同一路由模板共享配额
+			rec = do(engine, "/user/2", "alice")
+			if rec.Code != http.StatusTooManyRequests || rec.Header().Get(HeaderRetryAfter) != "1" {
+				t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+			}
+			body := DataResp{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != ErrCodeTooManyRequests {
+				t.Fatalf("unexpected body %s", rec.Body.String())
+			}
+			// 其他客户端不受影响, 无标识不限流
+			if rec := do(engine, "/user/1", "bob"); rec.Code != http.StatusOK {
+				t.Fatalf("unexpected code %d", rec.Code)
+			}
+			for i := 0; i < 3; i++ {
+				if rec := do(engine, "/user/1", ""); rec.Code != http.StatusOK {
+					t.Fatalf("unexpected code %d", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+// errRateLimitTaker Take 一直出错
+type errRateLimitTaker struct{}
+
+func (errRateLimitTaker) Take(ctx context.Context, key string, r, b int) (RateLimitResult, error) {
+	return RateLimitResult{}, fmt.Errorf("limiter unavailable")
+}
+
+func TestMidClientLimiter_FailClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	redisLim := newTestRedisRateLimiter(t, mr)
+	mr.Close()
+	cases := []struct {
+		cfg  *ClientLimiterConf
+		code int
+	}{
+		{&ClientLimiterConf{Rate: 1, Limiter: errRateLimitTaker{}}, http.StatusOK},
+		{&ClientLimiterConf{Rate: 1, Limiter: errRateLimitTaker{}, FailClosed: true}, http.StatusTooManyRequests},
+		// 沿用 RedisRateLimiterConf.FailClosed
+		{&ClientLimiterConf{Rate: 1, Limiter: redisLim}, http.StatusTooManyRequests},
+	}
+	for i, v := range cases {
+		engine := gin.New()
+		engine.GET("/ping", Gin.MidClientLimiter(v.cfg), func(c *gin.Context) {
+			c.String(http.StatusOK, "pong")
+		})
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		if rec.Code != v.code {
+			t.Fatalf("case %d expect %d, got %d", i, v.code, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package httplib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断打开, 可以通过 errors.Is 判断, 具体信息通过 errors.As 获取 *CircuitOpenError
+var ErrCircuitOpen = errors.New("httplib: circuit breaker is open")
+
+// CircuitOpenError 熔断打开时快速失败的错误
+type CircuitOpenError struct {
+	Name       string
+	RetryAfter time.Duration // 距离进入半开状态的时间
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("httplib: circuit breaker %s is open, retry after %s", e.Name, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type CircuitState int
+
+const (
+	StateClosed   CircuitState = iota // 正常放行, 统计失败率
+	StateOpen                         // 快速失败, 冷却后进入半开
+	StateHalfOpen                     // 放行少量探测请求, 全部成功后关闭, 任一失败重新打开
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+type BreakerSettings struct {
+	FailureRatio     float64       // 窗口内失败率达到该值时打开, 默认 0.5
+	MinRequests      int           // 窗口内请求数达到该值才计算失败率, 默认 20
+	Window           time.Duration // 关闭状态的统计窗口, 默认 10s
+	CoolDown         time.Duration // 打开状态持续时间, 默认 5s
+	HalfOpenRequests int           // 半开状态的探测请求数, 默认 1
+	// IsFailure 判断 HTTP 请求是否失败, 默认 err 不为空或状态码 >= 500
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange 状态变化回调, 在锁外调用
+	OnStateChange func(name string, from, to CircuitState)
+}
+
+func (s *BreakerSettings) validate() {
+	if s.FailureRatio <= 0 || s.FailureRatio > 1 {
+		s.FailureRatio = 0.5
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = 20
+	}
+	if s.Window <= 0 {
+		s.Window = 10 * time.Second
+	}
+	if s.CoolDown <= 0 {
+		s.CoolDown = 5 * time.Second
+	}
+	if s.HalfOpenRequests <= 0 {
+		s.HalfOpenRequests = 1
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || (resp != nil && resp.StatusCode >= http.StatusInternalServerError)
+		}
+	}
+}
+
+// breakerOutcome 请求结果
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	breakerIgnore // 调用方主动取消, 释放放行名额, 不计入统计
+)
+
+// ctxOutcome 调用方取消 ctx 导致的失败不计入统计; ctx 超时视为失败, 下游无响应时同样可以触发熔断
+func ctxOutcome(ctx context.Context, err error, failed bool) breakerOutcome {
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return breakerIgnore
+	}
+	if failed {
+		return breakerFailure
+	}
+	return breakerSuccess
+}
+
+// CircuitBreaker 熔断器, 并发安全, 可以独立包装任意 func(ctx) error
+type CircuitBreaker struct {
+	name     string
+	settings BreakerSettings
+
+	mutex       sync.Mutex
+	state       CircuitState
+	generation  uint64 // 状态或窗口变化时递增, 丢弃上一代请求的结果
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // 半开状态已放行的探测数
+	successes   int // 半开状态探测成功数
+}
+
+func NewCircuitBreaker(name string, settings ...BreakerSettings) *CircuitBreaker {
+	s := BreakerSettings{}
+	if len(settings) > 0 {
+		s = settings[0]
+	}
+	s.validate()
+	return &CircuitBreaker{
+		name:        name,
+		settings:    s,
+		windowStart: time.Now(),
+	}
+}
+
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	state, _ := cb.current(time.Now())
+	return state
+}
+
+// Allow 请求前检查, 打开时返回 *CircuitOpenError, 放行时返回 done, 请求结束后上报结果
+func (cb *CircuitBreaker) Allow() (done func(success bool), err error) {
+	report, err := cb.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(success bool) {
+		if success {
+			report(breakerSuccess)
+		} else {
+			report(breakerFailure)
+		}
+	}, nil
+}
+
+func (cb *CircuitBreaker) allow() (func(outcome breakerOutcome), error) {
+	now := time.Now()
+	cb.mutex.Lock()
+	state, changed := cb.current(now)
+	switch state {
+	case StateOpen:
+		retryAfter := cb.openedAt.Add(cb.settings.CoolDown).Sub(now)
+		cb.mutex.Unlock()
+		cb.notify(changed)
+		return nil, &CircuitOpenError{Name: cb.name, RetryAfter: retryAfter}
+	case StateHalfOpen:
+		if cb.probes >= cb.settings.HalfOpenRequests {
+			cb.mutex.Unlock()
+			cb.notify(changed)
+			return nil, &CircuitOpenError{Name: cb.name}
+		}
+		cb.probes++
+	default:
+		cb.requests++
+	}
+	generation := cb.generation
+	cb.mutex.Unlock()
+	cb.notify(changed)
+
+	var once sync.Once
+	return func(outcome breakerOutcome) {
+		once.Do(func() {
+			cb.report(generation, outcome)
+		})
+	}, nil
+}
+
+// Execute 通过熔断器执行 fn, fn 返回错误视为失败
+// 调用方取消 ctx 导致的错误不计入统计, 也不关闭半开状态; ctx 超时计入失败
+func (cb *CircuitBreaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	report, err := cb.allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			report(breakerFailure)
+			panic(r)
+		}
+	}()
+	err = fn(ctx)
+	report(ctxOutcome(ctx, err, err != nil))
+	return err
+}
+
+func (cb *CircuitBreaker) report(generation uint64, outcome breakerOutcome) {
+	now := time.Now()
+	cb.mutex.Lock()
+	state, changed := cb.current(now)
+	if generation != cb.generation {
+		cb.mutex.Unlock()
+		cb.notify(changed)
+		return
+	}
+	switch state {
+	case StateClosed:
+		if outcome == breakerIgnore {
+			cb.requests--
+			break
+		}
+		if outcome == breakerFailure {
+			cb.failures++
+		}
+		if cb.requests >= cb.settings.MinRequests &&
+			float64(cb.failures)/float64(cb.requests) >= cb.settings.FailureRatio {
+			changed = append(changed, cb.setState(StateOpen, now)...)
+		}
+	case StateHalfOpen:
+		if outcome == breakerIgnore {
+			// 释放探测名额, 等待下一个探测
+			cb.probes--
+			break
+		}
+		if outcome == breakerFailure {
+			changed = append(changed, cb.setState(StateOpen, now)...)
+			break
+		}
+		cb.successes++
+		if cb.successes >= cb.settings.HalfOpenRequests {
+			changed = append(changed, cb.setState(StateClosed, now)...)
+		}
+	}
+	cb.mutex.Unlock()
+	cb.notify(changed)
+}
+
+// current 按时间推进状态, 打开冷却结束进入半开, 关闭状态窗口到期清零, 调用方持有锁
+func (cb *CircuitBreaker) current(now time.Time) (CircuitState, []CircuitState) {
+	var changed []CircuitState
+	switch cb.state {
+	case StateOpen:
+		if !now.Before(cb.openedAt.Add(cb.settings.CoolDown)) {
+			changed = cb.setState(StateHalfOpen, now)
+		}
+	case StateClosed:
+		if now.Sub(cb.windowStart) >= cb.settings.Window {
+			cb.resetWindow(now)
+		}
+	}
+	return cb.state, changed
+}
+
+// setState 返回 {from, to} 供锁外回调
+func (cb *CircuitBreaker) setState(state CircuitState, now time.Time) []CircuitState {
+	if cb.state == state {
+		return nil
+	}
+	from := cb.state
+	cb.state = state
+	cb.resetWindow(now)
+	cb.probes, cb.successes = 0, 0
+	if state == StateOpen {
+		cb.openedAt = now
+	}
+	return []CircuitState{from, state}
+}
+
+func (cb *CircuitBreaker) resetWindow(now time.Time) {
+	cb.generation++
+	cb.windowStart = now
+	cb.requests, cb.failures = 0, 0
+}
+
+func (cb *CircuitBreaker) notify(changed []CircuitState) {
+	if cb.settings.OnStateChange == nil {
+		return
+	}
+	for i := 0; i+1 < len(changed); i += 2 {
+		cb.settings.OnStateChange(cb.name, changed[i], changed[i+1])
+	}
+}
+
+// Breakers 按 host 区分的熔断器, 可以在多个请求之间共享
+type Breakers struct {
+	settings BreakerSettings
+
+	mutex sync.Mutex
+	m     map[string]*CircuitBreaker
+}
+
+func NewBreakers(settings ...BreakerSettings) *Breakers {
+	s := BreakerSettings{}
+	if len(settings) > 0 {
+		s = settings[0]
+	}
+	s.validate()
+	return &Breakers{
+		settings: s,
+		m:        make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get host 对应的熔断器, 不存在时创建
+func (b *Breakers) Get(host string) *CircuitBreaker {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	cb, ok := b.m[host]
+	if !ok {
+		cb = NewCircuitBreaker(host, b.settings)
+		b.m[host] = cb
+	}
+	return cb
+}
+
+// States 所有 host 的熔断状态
+func (b *Breakers) States() map[string]CircuitState {
+	b.mutex.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(b.m))
+	for _, cb := range b.m {
+		breakers = append(breakers, cb)
+	}
+	b.mutex.Unlock()
+	states := make(map[string]CircuitState, len(breakers))
+	for _, cb := range breakers {
+		states[cb.name] = cb.State()
+	}
+	return states
+}
+
+// do 通过 host 的熔断器执行一次 HTTP 请求, 与 Execute 一致, 调用方取消不计入统计, 超时计入失败
+func (b *Breakers) do(ctx context.Context, host string, fn func() (*http.Response, error)) (*http.Response, error) {
+	report, err := b.Get(host).allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fn()
+	report(ctxOutcome(ctx, err, b.settings.IsFailure(resp, err)))
+	return resp, err
+}
@@ -0,0 +1,153 @@
+package httplib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerExecute(t *testing.T) {
+	cb := NewCircuitBreaker("svc", BreakerSettings{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		CoolDown:     50 * time.Millisecond,
+	})
+	ctx := context.Background()
+	fail := func(ctx context.Context) error { return errors.New("down") }
+	ok := func(ctx context.Context) error { return nil }
+
+	for _, fn := range []func(context.Context) error{ok, fail, ok, fail} {
+		_ = cb.Execute(ctx, fn)
+	}
+	if cb.State() != StateOpen {
+		t.Fatalf("expect open, got %s", cb.State())
+	}
+	err := cb.Execute(ctx, ok)
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.RetryAfter <= 0 {
+		t.Fatalf("expect circuit open error, got %v", err)
+	}
+
+	// 冷却后半开, 探测失败重新打开
+	time.Sleep(60 * time.Millisecond)
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("expect half-open, got %s", cb.State())
+	}
+	_ = cb.Execute(ctx, fail)
+	if cb.State() != StateOpen {
+		t.Fatalf("expect reopen, got %s", cb.State())
+	}
+
+	// 半开只放行一个探测, 探测成功后关闭
+	time.Sleep(60 * time.Millisecond)
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expect probe limited, got %v", err)
+	}
+	done(true)
+	if cb.State() != StateClosed {
+		t.Fatalf("expect closed, got %s", cb.State())
+	}
+}
+
+func TestDoRequestBreaker(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	breakers := NewBreakers(BreakerSettings{MinRequests: 2, CoolDown: time.Minute})
+	for i := 0; i < 2; i++ {
+		resp, err := Get(srv.URL).SetBreakers(breakers).DoRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	_, err := Get(srv.URL).SetBreakers(breakers).SetRetries(3).DoRequest()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expect circuit open, got %v", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Fatalf("expect 2 hits, got %d", n)
+	}
+	if states := breakers.States(); len(states) != 1 || states[srv.Listener.Addr().String()] != StateOpen {
+		t.Fatalf("unexpected states %v", states)
+	}
+}
+
+func TestDoRequestBreakerCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	// 调用方取消不计入统计
+	breakers := NewBreakers(BreakerSettings{MinRequests: 2, CoolDown: time.Minute})
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err := Get(srv.URL).WithContext(ctx).SetBreakers(breakers).DoRequest()
+		cancel()
+		if err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expect ctx error, got %v", err)
+		}
+	}
+	if state := breakers.Get(host).State(); state != StateClosed {
+		t.Fatalf("caller cancellation should not open circuit, got %v", state)
+	}
+
+	// 超时计入失败, 下游无响应时熔断
+	breakers = NewBreakers(BreakerSettings{MinRequests: 2, CoolDown: time.Minute})
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, _ = Get(srv.URL).WithContext(ctx).SetBreakers(breakers).DoRequest()
+		cancel()
+	}
+	if state := breakers.Get(host).State(); state != StateOpen {
+		t.Fatalf("deadline exceeded should open circuit, got %v", state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenCanceledProbe(t *testing.T) {
+	cb := NewCircuitBreaker("svc", BreakerSettings{MinRequests: 1, CoolDown: 20 * time.Millisecond})
+	_ = cb.Execute(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+	time.Sleep(30 * time.Millisecond)
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("expect half-open, got %s", cb.State())
+	}
+
+	// 探测被调用方取消, 不关闭也不重新打开, 释放探测名额
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cb.Execute(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("canceled probe should keep half-open, got %s", cb.State())
+	}
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("probe slot should released, got %v", err)
+	}
+	done(true)
+	if cb.State() != StateClosed {
+		t.Fatalf("expect closed, got %s", cb.State())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -102,7 +103,8 @@ type HTTPSettings struct {
 	DumpBody            bool
 	Retries             int // 如果设置 -1 则一直重试
 	KeepAlive           bool
-	MaxIdleConnsPerHost int // 默认 2
+	MaxIdleConnsPerHost int       // 默认 2
+	Breakers            *Breakers // 按 host 熔断, 打开时不再请求与重试
 }
 
 type HTTPRequest struct {
@@ -168,6 +170,12 @@ func (h *HTTPRequest) SetRetries(retries int) *HTTPRequest {
 	return h
 }
 
+// SetBreakers 按 host 熔断, 多个请求共享同一个 Breakers
+func (h *HTTPRequest) SetBreakers(breakers *Breakers) *HTTPRequest {
+	h.setting.Breakers = breakers
+	return h
+}
+
 func (h *HTTPRequest) SetDumpBody(dumpBody bool) *HTTPRequest {
 	h.setting.DumpBody = dumpBody
 	return h
@@ -547,7 +555,17 @@ func (h *HTTPRequest) DoRequest() (resp *http.Response, err error) {
 		if i > 0 {
 			h.req.Body = io.NopCloser(bytes.NewBuffer(h.forkReqBody))
 		}
-		resp, err = h.client.Do(h.req)
+		if h.setting.Breakers == nil {
+			resp, err = h.client.Do(h.req)
+		} else {
+			resp, err = h.setting.Breakers.do(h.req.Context(), h.req.URL.Host, func() (*http.Response, error) {
+				return h.client.Do(h.req)
+			})
+			if errors.Is(err, ErrCircuitOpen) {
+				// 熔断打开, 快速失败, 不再重试
+				return nil, err
+			}
+		}
 		if err == nil {
 			break
 		}
@@ -0,0 +1,207 @@
+package bkit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type LeaderElectorConf struct {
+	TTL           time.Duration // 租约, 默认 15s, 持有期间由锁句柄自动续期
+	RetryInterval time.Duration // 非 leader 时竞选间隔, 默认 TTL/3
+}
+
+func (c *LeaderElectorConf) Validate() error {
+	if c.TTL < time.Second {
+		c.TTL = 15 * time.Second
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = c.TTL / 3
+	}
+	return nil
+}
+
+// LeaderElector 通过 DistributedLocker 竞选 leader, 多个副本中同一时间只有一个 leader
+// 锁丢失或租约到期仍未续期成功时撤销 leader 并继续竞选, Shutdown 时主动让出
+type LeaderElector struct {
+	cfg    *LeaderElectorConf
+	locker DistributedLocker
+	name   string
+
+	mutex         sync.RWMutex
+	lock          *Lock
+	leaderCtx     context.Context
+	leaderCancel  func()
+	onElected     []func(ctx context.Context)
+	onRevoked     []func()
+	cancel        func()
+	done          chan struct{}
+	campaignStart sync.Once
+}
+
+func NewLeaderElector(locker DistributedLocker, name string, cfg ...*LeaderElectorConf) *LeaderElector {
+	conf := &LeaderElectorConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &LeaderElector{
+		cfg:    conf,
+		locker: locker,
+		name:   name,
+		done:   make(chan struct{}),
+	}
+}
+
+// OnElected 成为 leader 时在新的协程中回调, ctx 在失去 leader 时取消
+func (e *LeaderElector) OnElected(fn func(ctx context.Context)) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.onElected = append(e.onElected, fn)
+}
+
+// OnRevoked 失去 leader 时回调
+func (e *LeaderElector) OnRevoked(fn func()) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.onRevoked = append(e.onRevoked, fn)
+}
+
+// IsLeader 持有锁且租约未到期, 续期一直失败时到期即不再是 leader
+func (e *LeaderElector) IsLeader() bool {
+	return e.LeaderContext() != nil
+}
+
+// LeaderContext 当前任期的 ctx, 非 leader 或租约已到期返回 nil
+func (e *LeaderElector) LeaderContext() context.Context {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.lock == nil || !time.Now().Before(e.lock.Expire()) {
+		return nil
+	}
+	return e.leaderCtx
+}
+
+// Run 后台竞选, 立即返回
+func (e *LeaderElector) Run(ctx context.Context) error {
+	e.campaignStart.Do(func() {
+		ctx, cancel := context.WithCancel(ctx)
+		e.mutex.Lock()
+		e.cancel = cancel
+		e.mutex.Unlock()
+		go e.campaign(ctx)
+	})
+	return nil
+}
+
+func (e *LeaderElector) campaign(ctx context.Context) {
+	defer close(e.done)
+	for {
+		lock, err := e.locker.Acquire(ctx, e.name, e.cfg.TTL)
+		if err == nil {
+			e.elected(lock)
+			select {
+			case <-lock.Lost():
+				e.revoked()
+			case <-ctx.Done():
+				e.stepDown()
+				return
+			}
+			continue
+		}
+		if err != ErrAcquireLockFailed && ctx.Err() == nil {
+			log.Printf("WARNING: leader %s campaign %s\n", e.name, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.cfg.RetryInterval):
+		}
+	}
+}
+
+func (e *LeaderElector) elected(lock *Lock) {
+	e.mutex.Lock()
+	e.lock = lock
+	e.leaderCtx, e.leaderCancel = context.WithCancel(context.Background())
+	ctx := e.leaderCtx
+	fns := append([]func(ctx context.Context){}, e.onElected...)
+	e.mutex.Unlock()
+	for _, fn := range fns {
+		go fn(ctx)
+	}
+}
+
+// revoked 返回被撤销的锁
+func (e *LeaderElector) revoked() *Lock {
+	e.mutex.Lock()
+	lock := e.lock
+	if lock == nil {
+		e.mutex.Unlock()
+		return nil
+	}
+	e.lock = nil
+	e.leaderCancel()
+	e.leaderCtx, e.leaderCancel = nil, nil
+	fns := append([]func(){}, e.onRevoked...)
+	e.mutex.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+	return lock
+}
+
+// stepDown 让出 leader, 释放锁让其他副本尽快接任
+func (e *LeaderElector) stepDown() {
+	lock := e.revoked()
+	if lock == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lock.Release(ctx); err != nil && err != ErrLockLost {
+		log.Printf("WARNING: leader %s step down %s\n", e.name, err.Error())
+	}
+}
+
+// Shutdown 停止竞选, 是 leader 时主动让出, Run 的 ctx 结束时同样会让出
+func (e *LeaderElector) Shutdown(ctx context.Context) error {
+	e.mutex.RLock()
+	cancel := e.cancel
+	e.mutex.RUnlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Func 包装任务, 非 leader 时跳过, 执行期间失去 leader 会取消 ctx
+func (e *LeaderElector) Func(fn func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		leaderCtx := e.LeaderContext()
+		if leaderCtx == nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(leaderCtx, cancel)
+		defer stop()
+		fn(ctx)
+	}
+}
+
+// CronFunc 包装 cron 任务, 非 leader 时跳过
+func (e *LeaderElector) CronFunc(fn func()) func() {
+	return func() {
+		if e.IsLeader() {
+			fn()
+		}
+	}
+}
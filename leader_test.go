@@ -0,0 +1,140 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func waitFor(t *testing.T, d time.Duration, cond func() bool, msg string) {
+	deadline := time.Now().Add(d)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeaderElector(t *testing.T) {
+	mr := miniredis.RunT(t)
+	conf := &LeaderElectorConf{TTL: time.Second, RetryInterval: 20 * time.Millisecond}
+	e1 := NewLeaderElector(newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_1"), "leader", conf)
+	e2 := NewLeaderElector(newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_2"), "leader", conf)
+
+	var elected, revoked int32
+	e1.OnElected(func(ctx context.Context) {
+		atomic.AddInt32(&elected, 1)
+		<-ctx.Done()
+	})
+	e1.OnRevoked(func() {
+		atomic.AddInt32(&revoked, 1)
+	})
+
+	_ = e1.Run(context.Background())
+	waitFor(t, time.Second, e1.IsLeader, "e1 should leader")
+	_ = e2.Run(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	if e2.IsLeader() {
+		t.Fatal("e2 should not leader")
+	}
+
+	// 锁被删除, 续期失败撤销 leader
+	mr.Del("bkit:lock:leader")
+	_ = mr.Set("bkit:lock:leader", "owner_3")
+	waitFor(t, 2*time.Second, func() bool { return atomic.LoadInt32(&revoked) == 1 }, "e1 should revoked")
+	if atomic.LoadInt32(&elected) != 1 {
+		t.Fatal("elected should call once")
+	}
+	mr.Del("bkit:lock:leader")
+	waitFor(t, time.Second, func() bool { return e1.IsLeader() || e2.IsLeader() }, "should elect new leader")
+
+	// leader 让出, 另一个接任
+	leader, follower := e1, e2
+	if e2.IsLeader() {
+		leader, follower = e2, e1
+	}
+	if err := leader.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if leader.IsLeader() {
+		t.Fatal("should step down")
+	}
+	waitFor(t, time.Second, follower.IsLeader, "follower should leader")
+	_ = follower.Shutdown(context.Background())
+	if mr.Exists("bkit:lock:leader") {
+		t.Fatal("lock should released")
+	}
+}
+
+func TestLeaderElector_Deadline(t *testing.T) {
+	mr := miniredis.RunT(t)
+	conf := &LeaderElectorConf{TTL: time.Second, RetryInterval: 20 * time.Millisecond}
+	e := NewLeaderElector(newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_1"), "leader", conf)
+	var revoked int32
+	e.OnRevoked(func() {
+		atomic.AddInt32(&revoked, 1)
+	})
+	_ = e.Run(context.Background())
+	defer e.Shutdown(context.Background())
+	waitFor(t, time.Second, e.IsLeader, "should leader")
+
+	// redis 不可用, 续期只返回 IO 错误, 租约到期即让出
+	mr.Close()
+	start := time.Now()
+	waitFor(t, 3*time.Second, func() bool { return !e.IsLeader() }, "should step down at lease deadline")
+	if time.Since(start) > conf.TTL+500*time.Millisecond {
+		t.Fatalf("step down too late %s", time.Since(start))
+	}
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&revoked) == 1 }, "should revoked")
+}
+
+func TestLeaderElector_RunShutdown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	e := NewLeaderElector(newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_1"), "leader")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = e.Run(context.Background())
+	}()
+	_ = e.Shutdown(context.Background())
+	<-done
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTaskServer_Leader(t *testing.T) {
+	mr := miniredis.RunT(t)
+	conf := &LeaderElectorConf{TTL: time.Second, RetryInterval: 20 * time.Millisecond}
+	var runs [2]int32
+	servers := make([]*TaskServer, 2)
+	for i := range servers {
+		i := i
+		servers[i] = NewTaskServer()
+		if err := servers[i].AddLeaderTickerTimeAfterFunc(10*time.Millisecond, func(ctx context.Context) {
+			atomic.AddInt32(&runs[i], 1)
+		}); err == nil {
+			t.Fatal("should require leader elector")
+		}
+		servers[i].SetLeaderElector(NewLeaderElector(newTestRedisLocker(t, []*miniredis.Miniredis{mr}, fmt.Sprintf("owner_%d", i)), "task", conf))
+		if err := servers[i].AddLeaderTickerTimeAfterFunc(10*time.Millisecond, func(ctx context.Context) {
+			atomic.AddInt32(&runs[i], 1)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		_ = servers[i].Run(context.Background())
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, s := range servers {
+		_ = s.Shutdown(context.Background())
+	}
+	r0, r1 := atomic.LoadInt32(&runs[0]), atomic.LoadInt32(&runs[1])
+	if (r0 == 0) == (r1 == 0) {
+		t.Fatalf("only leader should run %d %d", r0, r1)
+	}
+}
@@ -1,6 +1,7 @@
 package bkit
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"sync"
@@ -13,7 +14,17 @@ var ErrAcquireLockFailed = fmt.Errorf("acquire lock failed")
 
 type DistributedLocker interface {
 	// AcquireLock 加锁 err: nil 取锁成功，ErrAcquireLock 时表示获取锁失败， 其他错误表示获取锁时发生错误，一般是IO错误
+	// 同一个 locker 已持有时直接返回 nil(可重入), 同一进程内多个协程互斥使用 AcquireLockCtx 或 Acquire
+	// 实现 LockAdmin 的 locker 重入前会到存储确认仍是持有者, 锁被 ForceRelease 后重新竞争
 	AcquireLock(name string, ttl time.Duration) error
+	// AcquireLockCtx 阻塞加锁, 退避重试直到获取锁或 ctx 结束, 同一个 locker 已持有时等待 ReleaseLock
+	AcquireLockCtx(ctx context.Context, name string, ttl time.Duration, cfg ...*AcquireLockConf) error
+	// Acquire 加锁并返回锁句柄, 句柄在 Release 前自动续期, 同一个 locker 已持有时返回 ErrAcquireLockFailed
+	Acquire(ctx context.Context, name string, ttl time.Duration, cfg ...*LockConf) (*Lock, error)
+	// ExtendLock 续期, 锁已不属于自己时返回 ErrLockLost
+	ExtendLock(ctx context.Context, name string, ttl time.Duration) error
+	// Token 当前持有锁的 fencing token, 同一个锁每次获取严格递增, 未持有返回 ErrLockLost
+	Token(name string) (int64, error)
 	// ReleaseLock 释放锁
 	ReleaseLock(name string) error
 	// ReleaseAllLocks 释放所有锁
@@ -27,16 +38,24 @@ type _distributedLock struct {
 	Owner     string
 	Expire    time.Time
 	CreatedAt time.Time
+	Token     int64
+	Mode      string // 读写锁与信号量的模式
 }
 
+var _ DistributedLocker = &MysqlDistributedLocker{}
+
 // 通过Mysql 实现的分布式锁
 type MysqlDistributedLocker struct {
-	db        *sql.DB
-	tableName string
-	owner     string
+	db          *sql.DB
+	tableName   string
+	holderTable string
+	owner       string
+	waiter      *LockWaiter
+	counter     LockCounter
 
-	mutex sync.Mutex
-	m     map[string]_distributedLock
+	mutex  sync.Mutex
+	m      map[string]_distributedLock
+	shared map[string]_distributedLock // 持有者 id -> 读写锁与信号量
 }
 
 // NewMysqlLocker 创建一个基于mysql的分布式锁, 适用于不太频繁的场景
@@ -46,10 +65,13 @@ func NewMysqlDistributedLocker(dataSourceName, owner string) (*MysqlDistributedL
 		return nil, err
 	}
 	lock := &MysqlDistributedLocker{
-		db:        db,
-		tableName: "_distributed_locks",
-		owner:     owner,
-		m:         make(map[string]_distributedLock),
+		db:          db,
+		tableName:   "_distributed_locks",
+		holderTable: "_distributed_lock_holders",
+		owner:       owner,
+		waiter:      NewLockWaiter(),
+		m:           make(map[string]_distributedLock),
+		shared:      make(map[string]_distributedLock),
 	}
 	// 初始化表, lock_key 为锁的key, expire 为锁的过期时间
 	_, err = lock.db.Exec(fmt.Sprintf(`
@@ -57,13 +79,46 @@ func NewMysqlDistributedLocker(dataSourceName, owner string) (*MysqlDistributedL
 			lock_name VARCHAR(255) PRIMARY KEY,
             owner  VARCHAR(255) NOT NULL,
 			expire BIGINT NOT NULL,
-			created_at BIGINT NOT NULL
+			created_at BIGINT NOT NULL,
+			token BIGINT NOT NULL DEFAULT 0
 		)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='用于分布式锁的日志表';`, lock.tableName))
 	if err != nil {
 		return nil, fmt.Errorf("create table _lock_log: %w", err)
 	}
+	if err := lock.migrateToken(); err != nil {
+		return nil, fmt.Errorf("migrate table _lock_log: %w", err)
+	}
+	// 读写锁与信号量的持有者, owner 为空的记录用于串行化获取
+	_, err = lock.db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			lock_name VARCHAR(255) NOT NULL,
+			owner  VARCHAR(255) NOT NULL,
+			mode VARCHAR(8) NOT NULL,
+			expire BIGINT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (lock_name, owner)
+		)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='用于读写锁与信号量的持有者表';`, lock.holderTable))
+	if err != nil {
+		return nil, fmt.Errorf("create table %s: %w", lock.holderTable, err)
+	}
 	return lock, nil
 }
+
+// migrateToken 旧表增加 token 字段
+func (lock *MysqlDistributedLocker) migrateToken() error {
+	var n int
+	if err := lock.db.QueryRow(`
+	SELECT COUNT(*) FROM information_schema.COLUMNS
+	WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'token'`, lock.tableName).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := lock.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN token BIGINT NOT NULL DEFAULT 0", lock.tableName))
+	return err
+}
+
 func (lock *MysqlDistributedLocker) Close() error {
 	if lock.db == nil {
 		return nil
@@ -73,6 +128,11 @@ func (lock *MysqlDistributedLocker) Close() error {
 
 // AcquireLock 加锁
 func (lock *MysqlDistributedLocker) AcquireLock(name string, ttl time.Duration) error {
+	return lock.acquireLock(name, ttl, true)
+}
+
+// acquireLock reentrant=false 时本地已持有返回 ErrAcquireLockFailed
+func (lock *MysqlDistributedLocker) acquireLock(name string, ttl time.Duration, reentrant bool) error {
 	if ttl < time.Second {
 		ttl = time.Second
 	}
@@ -82,25 +142,41 @@ func (lock *MysqlDistributedLocker) AcquireLock(name string, ttl time.Duration)
 	//  先本地判断是否已经加锁
 	if v, ok := lock.m[name]; ok {
 		if v.Expire.After(time.Now()) {
-			return nil
+			if !reentrant {
+				return ErrAcquireLockFailed
+			}
+			// 本地记录可能已被其他节点 ForceRelease, 到存储确认
+			held, err := lock.stillHeld(v)
+			if err != nil {
+				return err
+			}
+			if held {
+				return nil
+			}
 		}
-		// 过期了, 删除
+		// 过期或已被强制释放, 删除
 		delete(lock.m, name)
 	}
 	expire := time.Now().Add(ttl)
 	// 本地没有, 则去数据库获取锁
 	var (
-		ok  bool
-		err error
+		ok    bool
+		token int64
+		err   error
 	)
 
+	start := time.Now()
 	Retry.RetryN(1, time.Second, func() error {
-		ok, err = lock.tryAcquireLock(name, expire)
+		token, ok, err = lock.tryAcquireLock(name, expire)
 		if err != nil {
 			return err
 		}
 		return nil
 	})
+	lock.counter.Observe(start, ok, err)
+	if err != nil {
+		return err
+	}
 
 	if ok {
 		lock.m[name] = _distributedLock{
@@ -108,30 +184,133 @@ func (lock *MysqlDistributedLocker) AcquireLock(name string, ttl time.Duration)
 			Owner:     lock.owner,
 			Expire:    expire,
 			CreatedAt: time.Now(),
+			Token:     token,
 		}
 		return nil
 	}
 	return ErrAcquireLockFailed
 }
 
-func (lock *MysqlDistributedLocker) tryAcquireLock(name string, expire time.Time) (bool, error) {
+// tryAcquireLock 获取成功时 token 加 1, expire 必须最后更新
+func (lock *MysqlDistributedLocker) tryAcquireLock(name string, expire time.Time) (int64, bool, error) {
 	result, err := lock.db.Exec(fmt.Sprintf(`
-	INSERT INTO %s (lock_name, owner, expire, created_at)
-	VALUES (?, ?, ?, UNIX_TIMESTAMP())
+	INSERT INTO %s (lock_name, owner, expire, created_at, token)
+	VALUES (?, ?, ?, UNIX_TIMESTAMP(), 1)
 	ON DUPLICATE KEY UPDATE
 		owner = IF(expire < UNIX_TIMESTAMP(), VALUES(owner), owner),
 		created_at = IF(expire < UNIX_TIMESTAMP(), VALUES(created_at), created_at),
+		token = IF(expire < UNIX_TIMESTAMP(), token + 1, token),
 		expire = IF(expire < UNIX_TIMESTAMP(), VALUES(expire), expire)`, lock.tableName),
 		name, lock.owner, expire.Unix())
 	if err != nil {
-		return false, err
+		return 0, false, err
 	}
 
 	affected, err := result.RowsAffected()
 	if err != nil {
+		return 0, false, err
+	}
+	if affected == 0 {
+		return 0, false, nil
+	}
+	var token int64
+	if err := lock.db.QueryRow(fmt.Sprintf("SELECT token FROM %s WHERE lock_name = ? AND owner = ?", lock.tableName),
+		name, lock.owner).Scan(&token); err != nil {
+		return 0, false, err
+	}
+	return token, true, nil
+}
+
+// stillHeld 存储中仍是自己持有且 token 未变化
+func (lock *MysqlDistributedLocker) stillHeld(v _distributedLock) (bool, error) {
+	var n int
+	if err := lock.db.QueryRow(fmt.Sprintf(`
+	SELECT COUNT(*) FROM %s WHERE lock_name = ? AND owner = ? AND token = ? AND expire >= UNIX_TIMESTAMP()`, lock.tableName),
+		v.LockName, lock.owner, v.Token).Scan(&n); err != nil {
 		return false, err
 	}
-	return affected != 0, nil
+	return n > 0, nil
+}
+
+// AcquireLockCtx 阻塞加锁
+func (lock *MysqlDistributedLocker) AcquireLockCtx(ctx context.Context, name string, ttl time.Duration, cfg ...*AcquireLockConf) error {
+	err := lock.waiter.Wait(ctx, name, func() error {
+		return lock.acquireLock(name, ttl, false)
+	}, cfg...)
+	if err != nil && ctx.Err() != nil {
+		lock.counter.Timeout()
+	}
+	return err
+}
+
+// Acquire 加锁并返回锁句柄
+func (lock *MysqlDistributedLocker) Acquire(ctx context.Context, name string, ttl time.Duration, cfg ...*LockConf) (*Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	if err := lock.acquireLock(name, ttl, false); err != nil {
+		return nil, err
+	}
+	token, err := lock.Token(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewLock(lock, name, ttl, token, cfg...), nil
+}
+
+// Token 当前持有锁的 fencing token
+func (lock *MysqlDistributedLocker) Token(name string) (int64, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	v, ok := lock.m[name]
+	if !ok || !v.Expire.After(time.Now()) {
+		return 0, ErrLockLost
+	}
+	return v.Token, nil
+}
+
+// ExtendLock 续期
+func (lock *MysqlDistributedLocker) ExtendLock(ctx context.Context, name string, ttl time.Duration) error {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	v, ok := lock.m[name]
+	if !ok {
+		return ErrLockLost
+	}
+	expire := time.Now().Add(ttl)
+	result, err := lock.db.ExecContext(ctx, fmt.Sprintf(`
+	UPDATE %s SET expire = ? WHERE lock_name = ? AND owner = ? AND expire >= UNIX_TIMESTAMP()`, lock.tableName),
+		expire.Unix(), name, lock.owner)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// expire 未变化时 affected 也为 0, 再确认一次
+		var n int
+		if err := lock.db.QueryRowContext(ctx, fmt.Sprintf(`
+	SELECT COUNT(*) FROM %s WHERE lock_name = ? AND owner = ? AND expire >= UNIX_TIMESTAMP()`, lock.tableName),
+			name, lock.owner).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			delete(lock.m, name)
+			return ErrLockLost
+		}
+	}
+	v.Expire = expire
+	lock.m[name] = v
+	return nil
 }
 
 // ReleaseLock 释放锁
@@ -156,7 +335,8 @@ func (lock *MysqlDistributedLocker) ReleaseLock(key string) error {
 	return nil
 }
 func (lock *MysqlDistributedLocker) tryRelease(v _distributedLock) error {
-	_, err := lock.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE lock_name = ? AND owner = ?", lock.tableName), v.LockName, lock.owner)
+	// 保留记录使 token 继续递增, 只置为过期
+	_, err := lock.db.Exec(fmt.Sprintf("UPDATE %s SET expire = 0 WHERE lock_name = ? AND owner = ?", lock.tableName), v.LockName, lock.owner)
 	return err
 }
 
@@ -172,5 +352,11 @@ func (lock *MysqlDistributedLocker) ReleaseAllLocks() error {
 		}
 	}
 	lock.m = make(map[string]_distributedLock)
+	for holder, v := range lock.shared {
+		if err := lock.tryReleaseShared(v.LockName, holder); err != nil {
+			return err
+		}
+	}
+	lock.shared = make(map[string]_distributedLock)
 	return nil
 }
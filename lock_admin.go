@@ -0,0 +1,163 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LockInfo 锁持有者信息
+type LockInfo struct {
+	Name      string
+	Owner     string
+	Mode      string // 互斥锁为空, 读写锁与信号量为 LockModeRead/LockModeWrite/LockModeSemaphore
+	Expire    time.Time
+	CreatedAt time.Time
+	Token     int64 // 互斥锁的 fencing token
+}
+
+// LockAdmin 锁管理
+type LockAdmin interface {
+	// ListLocks 列出名称前缀匹配且未过期的持有者
+	ListLocks(ctx context.Context, prefix string) ([]LockInfo, error)
+	// ForceRelease 强制释放锁, 不检查 owner, 只清理当前节点的本地记录
+	// 其他节点上的原持有者在续期时得到 ErrLockLost, 锁句柄通过 Lost 通知, 重入 AcquireLock 时到存储确认后重新竞争
+	// 续期前原持有者仍认为自己持有, 受保护的写入需要携带 fencing token 校验
+	ForceRelease(ctx context.Context, name string) error
+	// ReapExpired 清理过期的持有者, 返回清理数量
+	// 互斥锁的记录保留用于 token 递增, 只清空 owner; 读写锁与信号量的持有者记录直接删除
+	ReapExpired(ctx context.Context) (int64, error)
+}
+
+// RunLockReaper 每隔 interval 清理一次过期持有者, 阻塞直到 ctx 结束
+//
+//	go bkit.RunLockReaper(ctx, locker, time.Minute)
+func RunLockReaper(ctx context.Context, admin LockAdmin, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := admin.ReapExpired(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("WARNING: lock reaper %s\n", err.Error())
+		}
+	}
+}
+
+func sortLockInfos(infos []LockInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Owner < infos[j].Owner
+	})
+}
+
+var _ LockAdmin = &MysqlDistributedLocker{}
+var _ LockStater = &MysqlDistributedLocker{}
+
+// Stats 加锁统计
+func (lock *MysqlDistributedLocker) Stats() LockStats {
+	return lock.counter.Stats()
+}
+
+// likePrefix 转义 LIKE 通配符
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+// ListLocks 列出未过期的持有者
+func (lock *MysqlDistributedLocker) ListLocks(ctx context.Context, prefix string) ([]LockInfo, error) {
+	infos := make([]LockInfo, 0)
+	rows, err := lock.db.QueryContext(ctx, fmt.Sprintf(`
+	SELECT lock_name, owner, expire, created_at, token FROM %s
+	WHERE lock_name LIKE ? AND owner <> '' AND expire >= UNIX_TIMESTAMP()`, lock.tableName), likePrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			v                 LockInfo
+			expire, createdAt int64
+		)
+		if err := rows.Scan(&v.Name, &v.Owner, &expire, &createdAt, &v.Token); err != nil {
+			return nil, err
+		}
+		v.Expire, v.CreatedAt = time.Unix(expire, 0), time.Unix(createdAt, 0)
+		infos = append(infos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	holders, err := lock.db.QueryContext(ctx, fmt.Sprintf(`
+	SELECT lock_name, owner, mode, expire, created_at FROM %s
+	WHERE lock_name LIKE ? AND owner <> '' AND expire >= UNIX_TIMESTAMP()`, lock.holderTable), likePrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer holders.Close()
+	for holders.Next() {
+		var (
+			v                 LockInfo
+			expire, createdAt int64
+		)
+		if err := holders.Scan(&v.Name, &v.Owner, &v.Mode, &expire, &createdAt); err != nil {
+			return nil, err
+		}
+		v.Expire, v.CreatedAt = time.Unix(expire, 0), time.Unix(createdAt, 0)
+		infos = append(infos, v)
+	}
+	if err := holders.Err(); err != nil {
+		return nil, err
+	}
+	sortLockInfos(infos)
+	return infos, nil
+}
+
+// ForceRelease 强制释放互斥锁与读写锁/信号量的所有持有者
+func (lock *MysqlDistributedLocker) ForceRelease(ctx context.Context, name string) error {
+	if _, err := lock.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET expire = 0 WHERE lock_name = ?", lock.tableName), name); err != nil {
+		return err
+	}
+	if _, err := lock.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE lock_name = ? AND owner <> ''", lock.holderTable), name); err != nil {
+		return err
+	}
+	lock.mutex.Lock()
+	delete(lock.m, name)
+	for holder, v := range lock.shared {
+		if v.LockName == name {
+			delete(lock.shared, holder)
+		}
+	}
+	lock.mutex.Unlock()
+	return nil
+}
+
+// ReapExpired 清理过期持有者
+func (lock *MysqlDistributedLocker) ReapExpired(ctx context.Context) (int64, error) {
+	ret, err := lock.db.ExecContext(ctx, fmt.Sprintf(`
+	UPDATE %s SET owner = '' WHERE owner <> '' AND expire < UNIX_TIMESTAMP()`, lock.tableName))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := ret.RowsAffected()
+	ret, err = lock.db.ExecContext(ctx, fmt.Sprintf(`
+	DELETE FROM %s WHERE owner <> '' AND expire < UNIX_TIMESTAMP()`, lock.holderTable))
+	if err != nil {
+		return n, err
+	}
+	m, _ := ret.RowsAffected()
+	return n + m, nil
+}
@@ -0,0 +1,203 @@
+package bkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrLockLost 锁已过期或被其他 owner 持有
+var ErrLockLost = fmt.Errorf("lock lost")
+
+// LockLeaser 锁续期与释放, DistributedLocker 的子集
+type LockLeaser interface {
+	// ExtendLock 续期, 锁已不属于自己时返回 ErrLockLost
+	ExtendLock(ctx context.Context, name string, ttl time.Duration) error
+	ReleaseLock(name string) error
+}
+
+type LockConf struct {
+	// RenewInterval 看门狗续期间隔, 默认 ttl/3, 小于 0 关闭看门狗
+	RenewInterval time.Duration
+}
+
+func (c *LockConf) Validate() error {
+	return nil
+}
+
+// Lock 锁句柄, 看门狗在持有期间自动续期, 到最后一次确认的租约到期时间仍未续期成功则通过 Lost 通知
+type Lock struct {
+	name   string
+	ttl    time.Duration
+	token  int64
+	cfg    *LockConf
+	leaser LockLeaser
+
+	mutex       sync.Mutex
+	expire      time.Time
+	expireTimer *time.Timer // 租约到期时检查是否已续期
+	released    bool
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewLock 已经获取到锁后创建句柄, 由 DistributedLocker.Acquire 调用
+func NewLock(leaser LockLeaser, name string, ttl time.Duration, token int64, cfg ...*LockConf) *Lock {
+	conf := &LockConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		c := *cfg[0]
+		conf = &c
+	}
+	_ = conf.Validate()
+	if conf.RenewInterval == 0 {
+		conf.RenewInterval = ttl / 3
+	}
+	l := &Lock{
+		name:   name,
+		ttl:    ttl,
+		token:  token,
+		cfg:    conf,
+		leaser: leaser,
+		expire: time.Now().Add(ttl),
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	l.mutex.Lock()
+	l.expireTimer = time.AfterFunc(ttl, l.checkExpire)
+	l.mutex.Unlock()
+	if conf.RenewInterval > 0 {
+		go l.watchdog()
+	} else {
+		close(l.done)
+	}
+	return l
+}
+
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token 获取锁时的 fencing token, 写存储时携带, 存储拒绝比已见过的 token 小的写入
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Expire 当前租约到期时间
+func (l *Lock) Expire() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.expire
+}
+
+// Lost 锁丢失时关闭
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
+
+// checkExpire 租约到期时未续期则通知 Lost, 不等待下一次续期失败
+func (l *Lock) checkExpire() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.released {
+		return
+	}
+	if d := time.Until(l.expire); d > 0 {
+		l.expireTimer.Reset(d)
+		return
+	}
+	l.markLost()
+}
+
+func (l *Lock) watchdog() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-l.lost:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.cfg.RenewInterval)
+		err := l.Refresh(ctx)
+		cancel()
+		if err != nil && !errors.Is(err, ErrLockLost) {
+			log.Printf("WARNING: lock %s refresh %s\n", l.name, err.Error())
+		}
+	}
+}
+
+// Refresh 立即续期一个 ttl, IO 错误时租约未到期仍然持有锁
+func (l *Lock) Refresh(ctx context.Context) error {
+	select {
+	case <-l.lost:
+		return ErrLockLost
+	default:
+	}
+	l.mutex.Lock()
+	released := l.released
+	l.mutex.Unlock()
+	if released {
+		return fmt.Errorf("%s lock released", l.name)
+	}
+
+	expire := time.Now().Add(l.ttl)
+	err := l.leaser.ExtendLock(ctx, l.name, l.ttl)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err == nil {
+		l.expire = expire
+		return nil
+	}
+	if errors.Is(err, ErrLockLost) || time.Now().After(l.expire) {
+		l.markLost()
+		return ErrLockLost
+	}
+	return err
+}
+
+// Release 停止续期并释放锁, 锁已丢失时返回 ErrLockLost
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	l.mutex.Lock()
+	if l.released {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.released = true
+	l.expireTimer.Stop()
+	l.mutex.Unlock()
+
+	err := l.leaser.ReleaseLock(l.name)
+	select {
+	case <-l.lost:
+		return ErrLockLost
+	default:
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLeaser struct {
+	mutex    sync.Mutex
+	extended int
+	lost     bool
+	err      error
+	released bool
+}
+
+func (l *testLeaser) ExtendLock(ctx context.Context, name string, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.lost {
+		return ErrLockLost
+	}
+	if l.err != nil {
+		return l.err
+	}
+	l.extended++
+	return nil
+}
+
+func (l *testLeaser) ReleaseLock(name string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.released = true
+	return nil
+}
+
+func TestLock_Watchdog(t *testing.T) {
+	leaser := &testLeaser{}
+	l := NewLock(leaser, "key", 300*time.Millisecond, 1)
+	time.Sleep(350 * time.Millisecond)
+	leaser.mutex.Lock()
+	extended := leaser.extended
+	leaser.mutex.Unlock()
+	if extended < 2 {
+		t.Fatalf("watchdog should extend, got %d", extended)
+	}
+	if err := l.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !leaser.released {
+		t.Fatal("should released")
+	}
+	if err := l.Refresh(context.Background()); err == nil {
+		t.Fatal("refresh after release should failed")
+	}
+
+	// 锁被抢占
+	leaser = &testLeaser{}
+	l = NewLock(leaser, "key", 300*time.Millisecond, 1)
+	leaser.mutex.Lock()
+	leaser.lost = true
+	leaser.mutex.Unlock()
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("should lost")
+	}
+	if err := l.Release(context.Background()); err != ErrLockLost {
+		t.Fatalf("release should lost, got %v", err)
+	}
+}
+
+func TestLock_RefreshErr(t *testing.T) {
+	ioErr := fmt.Errorf("io error")
+	leaser := &testLeaser{err: ioErr}
+	l := NewLock(leaser, "key", 300*time.Millisecond, 1, &LockConf{RenewInterval: -1})
+	// 租约未到期, IO 错误不算丢锁
+	if err := l.Refresh(context.Background()); err != ioErr {
+		t.Fatalf("should io error, got %v", err)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if err := l.Refresh(context.Background()); err != ErrLockLost {
+		t.Fatalf("lease expired should lost, got %v", err)
+	}
+	select {
+	case <-l.Lost():
+	default:
+		t.Fatal("should lost")
+	}
+}
+
+func TestLock_LostAtDeadline(t *testing.T) {
+	leaser := &testLeaser{err: fmt.Errorf("io error")}
+	// 续期间隔大于租约, 到期时没有续期失败也要通知
+	l := NewLock(leaser, "key", 100*time.Millisecond, 1, &LockConf{RenewInterval: time.Minute})
+	start := time.Now()
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("should lost at lease deadline")
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("lost before deadline %s", d)
+	}
+
+	// 续期成功后按新的到期时间检查
+	leaser = &testLeaser{}
+	l = NewLock(leaser, "key", 100*time.Millisecond, 1, &LockConf{RenewInterval: -1})
+	time.Sleep(60 * time.Millisecond)
+	if err := l.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	select {
+	case <-l.Lost():
+		t.Fatal("refreshed lock should not lost")
+	default:
+	}
+	_ = l.Release(context.Background())
+}
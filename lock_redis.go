@@ -0,0 +1,345 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 返回 {是否加锁成功, 节点当前 token}
+var redisLockAcquireScript = redis.NewScript(`
+local ok = redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2])
+local token = tonumber(redis.call('GET', KEYS[2]) or '0')
+if ok then
+	return {1, token}
+end
+return {0, token}`)
+
+// 仍持有锁时把节点 token 设置为 ARGV[2], 节点 token 已不小于 ARGV[2] 时返回 -1
+var redisLockTokenScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(redis.call('GET', KEYS[2]) or '0') >= tonumber(ARGV[2]) then
+	return -1
+end
+redis.call('SET', KEYS[2], ARGV[2])
+return 1`)
+
+var redisLockExtendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+var redisLockReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+type RedisLockConf struct {
+	Prefix      string        // key 前缀, 默认 bkit:lock:
+	NodeTimeout time.Duration // 单个节点请求超时, 默认 200ms, 需要远小于锁的 ttl
+	DriftFactor float64       // 时钟漂移系数, 默认 0.01
+}
+
+func (c *RedisLockConf) Validate() error {
+	if c.Prefix == "" {
+		c.Prefix = "bkit:lock:"
+	}
+	if c.NodeTimeout <= 0 {
+		c.NodeTimeout = 200 * time.Millisecond
+	}
+	if c.DriftFactor <= 0 {
+		c.DriftFactor = 0.01
+	}
+	return nil
+}
+
+var _ DistributedLocker = &RedisDistributedLocker{}
+
+// RedisDistributedLocker 通过 redis SET NX PX 实现的分布式锁, 释放和续期通过 lua 比较 owner
+// 多个相互独立的节点时为 Redlock 模式, 多数节点加锁成功且未超过有效期才算成功
+// 各节点的 token 会因为部分加锁失败等原因不一致, 加锁成功后取所有节点 token 的最大值加 1 作为新 token,
+// 再写回加锁成功的节点, 多数节点写回成功才算加锁成功, 任意两个多数派必然相交, 因此 token 严格递增
+type RedisDistributedLocker struct {
+	cfg     *RedisLockConf
+	clients []redis.UniversalClient
+	owner   string
+	quorum  int
+	waiter  *LockWaiter
+
+	mutex sync.Mutex
+	m     map[string]_distributedLock
+}
+
+// NewRedisDistributedLocker clients 由调用方管理, 一个 client 时为单节点模式
+func NewRedisDistributedLocker(clients []redis.UniversalClient, owner string, cfg ...*RedisLockConf) (*RedisDistributedLocker, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("redis clients required")
+	}
+	conf := &RedisLockConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &RedisDistributedLocker{
+		cfg:     conf,
+		clients: clients,
+		owner:   owner,
+		quorum:  len(clients)/2 + 1,
+		waiter:  NewLockWaiter(),
+		m:       make(map[string]_distributedLock),
+	}, nil
+}
+
+// Close 不关闭 clients
+func (lock *RedisDistributedLocker) Close() error {
+	return nil
+}
+
+func (lock *RedisDistributedLocker) keys(name string) []string {
+	return []string{lock.cfg.Prefix + name, lock.cfg.Prefix + name + ":token"}
+}
+
+// eval 在所有节点执行脚本, 返回每个节点的结果
+func (lock *RedisDistributedLocker) eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) ([]int64, []error) {
+	cmds := lock.evalCmds(ctx, lock.clients, script, keys, args...)
+	rets := make([]int64, len(cmds))
+	errs := make([]error, len(cmds))
+	for i, cmd := range cmds {
+		rets[i], errs[i] = cmd.Int64()
+	}
+	return rets, errs
+}
+
+// evalCmds 在 clients 上并发执行脚本
+func (lock *RedisDistributedLocker) evalCmds(ctx context.Context, clients []redis.UniversalClient, script *redis.Script, keys []string, args ...interface{}) []*redis.Cmd {
+	cmds := make([]*redis.Cmd, len(clients))
+	wg := sync.WaitGroup{}
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client redis.UniversalClient) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, lock.cfg.NodeTimeout)
+			defer cancel()
+			cmds[i] = script.Run(ctx, client, keys, args...)
+		}(i, client)
+	}
+	wg.Wait()
+	return cmds
+}
+
+// AcquireLock 加锁
+func (lock *RedisDistributedLocker) AcquireLock(name string, ttl time.Duration) error {
+	return lock.acquireLock(name, ttl, true)
+}
+
+// acquireLock reentrant=false 时本地已持有返回 ErrAcquireLockFailed
+func (lock *RedisDistributedLocker) acquireLock(name string, ttl time.Duration, reentrant bool) error {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	// 先本地判断是否已经加锁
+	if v, ok := lock.m[name]; ok {
+		if v.Expire.After(time.Now()) {
+			if !reentrant {
+				return ErrAcquireLockFailed
+			}
+			return nil
+		}
+		// 过期了, 删除
+		delete(lock.m, name)
+	}
+
+	start := time.Now()
+	keys := lock.keys(name)
+	cmds := lock.evalCmds(context.Background(), lock.clients, redisLockAcquireScript, keys, lock.owner, ttl.Milliseconds())
+	errs := make([]error, len(cmds))
+	held := 0
+	token := int64(0)
+	locked := make([]redis.UniversalClient, 0, len(cmds))
+	for i, cmd := range cmds {
+		var ret []int64
+		ret, errs[i] = cmd.Int64Slice()
+		if errs[i] != nil {
+			continue
+		}
+		if len(ret) != 2 {
+			errs[i] = fmt.Errorf("unexpected acquire result %v", ret)
+			continue
+		}
+		if ret[1] > token {
+			token = ret[1]
+		}
+		if ret[0] == 1 {
+			locked = append(locked, lock.clients[i])
+		} else {
+			held++
+		}
+	}
+	n := 0
+	if len(locked) >= lock.quorum {
+		// 新 token 大于所有节点已见过的 token, 写回多数节点后, 之后的多数派至少读到一个
+		token++
+		for _, cmd := range lock.evalCmds(context.Background(), locked, redisLockTokenScript, keys, lock.owner, token) {
+			if v, err := cmd.Int64(); err == nil && v == 1 {
+				n++
+			}
+		}
+	}
+	drift := time.Duration(float64(ttl)*lock.cfg.DriftFactor) + 2*time.Millisecond
+	validity := ttl - time.Since(start) - drift
+	if n >= lock.quorum && validity > 0 {
+		lock.m[name] = _distributedLock{
+			LockName:  name,
+			Owner:     lock.owner,
+			Expire:    start.Add(validity),
+			CreatedAt: time.Now(),
+			Token:     token,
+		}
+		return nil
+	}
+	// 未达到多数, 释放已加锁的节点
+	lock.eval(context.Background(), redisLockReleaseScript, keys, lock.owner)
+	// 被其他 owner 持有的节点达不到多数时, 失败原因是 IO 错误
+	if held <= len(lock.clients)-lock.quorum && errCount(errs) > 0 {
+		return ErrMulti(errs...)
+	}
+	return ErrAcquireLockFailed
+}
+
+func errCount(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// AcquireLockCtx 阻塞加锁
+func (lock *RedisDistributedLocker) AcquireLockCtx(ctx context.Context, name string, ttl time.Duration, cfg ...*AcquireLockConf) error {
+	return lock.waiter.Wait(ctx, name, func() error {
+		return lock.acquireLock(name, ttl, false)
+	}, cfg...)
+}
+
+// Acquire 加锁并返回锁句柄
+func (lock *RedisDistributedLocker) Acquire(ctx context.Context, name string, ttl time.Duration, cfg ...*LockConf) (*Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	if err := lock.acquireLock(name, ttl, false); err != nil {
+		return nil, err
+	}
+	token, err := lock.Token(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewLock(lock, name, ttl, token, cfg...), nil
+}
+
+// ExtendLock 续期, 多数节点续期成功才算成功
+func (lock *RedisDistributedLocker) ExtendLock(ctx context.Context, name string, ttl time.Duration) error {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	v, ok := lock.m[name]
+	if !ok {
+		return ErrLockLost
+	}
+	start := time.Now()
+	rets, errs := lock.eval(ctx, redisLockExtendScript, lock.keys(name), lock.owner, ttl.Milliseconds())
+	n, lost := 0, 0
+	for i, ret := range rets {
+		if errs[i] != nil {
+			continue
+		}
+		if ret > 0 {
+			n++
+		} else {
+			lost++
+		}
+	}
+	if n >= lock.quorum {
+		drift := time.Duration(float64(ttl)*lock.cfg.DriftFactor) + 2*time.Millisecond
+		v.Expire = start.Add(ttl - time.Since(start) - drift)
+		lock.m[name] = v
+		return nil
+	}
+	if lost > len(lock.clients)-lock.quorum {
+		delete(lock.m, name)
+		return ErrLockLost
+	}
+	return ErrMulti(errs...)
+}
+
+// Token 当前持有锁的 fencing token
+func (lock *RedisDistributedLocker) Token(name string) (int64, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	v, ok := lock.m[name]
+	if !ok || !v.Expire.After(time.Now()) {
+		return 0, ErrLockLost
+	}
+	return v.Token, nil
+}
+
+// ReleaseLock 释放锁
+func (lock *RedisDistributedLocker) ReleaseLock(name string) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if _, ok := lock.m[name]; !ok {
+		return fmt.Errorf("%s lock not found", lock.owner)
+	}
+	if err := lock.tryRelease(name); err != nil {
+		return err
+	}
+	delete(lock.m, name)
+	return nil
+}
+
+// tryRelease 多数节点失败时返回错误
+func (lock *RedisDistributedLocker) tryRelease(name string) error {
+	_, errs := lock.eval(context.Background(), redisLockReleaseScript, lock.keys(name), lock.owner)
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > len(lock.clients)-lock.quorum {
+		return ErrMulti(errs...)
+	}
+	return nil
+}
+
+// ReleaseAllLocks 释放所有锁
+func (lock *RedisDistributedLocker) ReleaseAllLocks() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	for name := range lock.m {
+		if err := lock.tryRelease(name); err != nil {
+			return err
+		}
+	}
+	lock.m = make(map[string]_distributedLock)
+	return nil
+}
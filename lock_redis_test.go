@@ -0,0 +1,201 @@
+package bkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisLocker(t *testing.T, servers []*miniredis.Miniredis, owner string) *RedisDistributedLocker {
+	clients := make([]redis.UniversalClient, 0, len(servers))
+	for _, mr := range servers {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		clients = append(clients, client)
+	}
+	// -race 下 miniredis 响应较慢, 节点超时放宽, 避免测试结果依赖调度
+	lock, err := NewRedisDistributedLocker(clients, owner, &RedisLockConf{NodeTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lock
+}
+
+func TestRedisDistributedLocker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_1")
+	lock2 := newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_2")
+
+	key := "test_key"
+	if err := lock.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	token1, _ := lock.Token(key)
+	if err := lock2.AcquireLock(key, 5*time.Second); err != ErrAcquireLockFailed {
+		t.Fatalf("AcquireLock 不应该获取到锁 %v", err)
+	}
+	// 其他 owner 不能释放
+	lock2.m[key] = _distributedLock{LockName: key}
+	_ = lock2.ReleaseLock(key)
+	if !mr.Exists("bkit:lock:" + key) {
+		t.Fatal("other owner should not release")
+	}
+
+	mr.FastForward(6 * time.Second)
+	if err := lock2.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatalf("AcquireLock 应该获取到锁 %v", err)
+	}
+	token2, _ := lock2.Token(key)
+	if token2 <= token1 {
+		t.Fatalf("token should increase %d %d", token1, token2)
+	}
+	// 过期后原持有者续期失败
+	if err := lock.ExtendLock(context.Background(), key, 5*time.Second); err != ErrLockLost {
+		t.Fatalf("should lost, got %v", err)
+	}
+
+	if err := lock2.ExtendLock(context.Background(), key, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("bkit:lock:" + key); ttl != 10*time.Second {
+		t.Fatalf("ttl should extended %s", ttl)
+	}
+	if err := lock2.ReleaseAllLocks(); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("bkit:lock:" + key) {
+		t.Fatal("should released")
+	}
+
+	l, err := lock.Acquire(context.Background(), key, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Token() <= token2 {
+		t.Fatal("token should increase")
+	}
+	if err := l.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisDistributedLocker_Redlock(t *testing.T) {
+	servers := []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t), miniredis.RunT(t)}
+	lock := newTestRedisLocker(t, servers, "owner_1")
+	lock2 := newTestRedisLocker(t, servers, "owner_2")
+
+	key := "test_key"
+	// 少数节点被其他 owner 持有, 仍然可以获取
+	servers[0].Set("bkit:lock:"+key, "owner_2")
+	if err := lock.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.AcquireLock(key, 5*time.Second); err != ErrAcquireLockFailed {
+		t.Fatalf("AcquireLock 不应该获取到锁 %v", err)
+	}
+	if err := lock.ReleaseLock(key); err != nil {
+		t.Fatal(err)
+	}
+	servers[0].Del("bkit:lock:" + key)
+
+	// 一个节点宕机
+	servers[2].Close()
+	if err := lock2.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.ReleaseLock(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多数节点宕机, 返回 IO 错误
+	servers[1].Close()
+	if err := lock.AcquireLock(key, 5*time.Second); err == nil || err == ErrAcquireLockFailed {
+		t.Fatalf("should io error, got %v", err)
+	}
+	if servers[0].Exists("bkit:lock:" + key) {
+		t.Fatal("failed acquire should release minority nodes")
+	}
+}
+
+func TestRedisDistributedLocker_RedlockToken(t *testing.T) {
+	servers := []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t), miniredis.RunT(t)}
+	lock := newTestRedisLocker(t, servers, "owner_1")
+	lock2 := newTestRedisLocker(t, servers, "owner_2")
+	key := "test_key"
+	tokenKey := "bkit:lock:" + key + ":token"
+
+	// 各节点 token 不一致
+	servers[0].Set(tokenKey, "100")
+	servers[1].Set(tokenKey, "5")
+	servers[2].Set(tokenKey, "5")
+	servers[2].Set("bkit:lock:"+key, "other")
+	if err := lock.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	token1, _ := lock.Token(key)
+	if token1 != 101 {
+		t.Fatalf("token should be max+1, got %d", token1)
+	}
+	if err := lock.ReleaseLock(key); err != nil {
+		t.Fatal(err)
+	}
+	servers[2].Del("bkit:lock:" + key)
+
+	// 另一个多数派 {1, 2}
+	servers[0].Set("bkit:lock:"+key, "other")
+	if err := lock2.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	token2, _ := lock2.Token(key)
+	if token2 <= token1 {
+		t.Fatalf("token should increase %d %d", token1, token2)
+	}
+}
+
+func TestRedisDistributedLocker_Local(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := newTestRedisLocker(t, []*miniredis.Miniredis{mr}, "owner_1")
+	key := "test_key"
+
+	l, err := lock.Acquire(context.Background(), key, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一个 locker 的其他调用方互斥
+	if _, err := lock.Acquire(context.Background(), key, 5*time.Second); err != ErrAcquireLockFailed {
+		t.Fatalf("local holder should exclude, got %v", err)
+	}
+	acquired := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		acquired <- lock.AcquireLockCtx(ctx, key, 5*time.Second)
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("should wait for local holder, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := l.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	// AcquireLock 保持可重入
+	if err := lock.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	_ = lock.ReleaseLock(key)
+
+	// IO 错误不转换为 ErrAcquireLockFailed
+	mr.Close()
+	if err := lock.AcquireLock(key, 5*time.Second); err == nil || err == ErrAcquireLockFailed {
+		t.Fatalf("should io error, got %v", err)
+	}
+}
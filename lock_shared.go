@@ -0,0 +1,299 @@
+package bkit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	LockModeRead      = "r" // 读锁, 没有写者时可以获取
+	LockModeWrite     = "w" // 写锁, 没有其他持有者时可以获取
+	LockModeSemaphore = "s" // 信号量, 持有者少于 permits 时可以获取
+)
+
+// SharedLocker 读写锁与信号量, 每次获取都是独立的持有者, 持有者 id 为 owner 加随机后缀
+// 同一个进程内的多个协程分别占用位置, 持有者记录与 _distributedLock 一致
+type SharedLocker interface {
+	// AcquireShared 加锁, permits 只在 mode=s 时有效, 返回持有者 id, 续期与释放时使用
+	AcquireShared(name, mode string, permits int, ttl time.Duration) (string, error)
+	// ExtendShared 续期, 持有者已过期或被删除时返回 ErrLockLost
+	ExtendShared(ctx context.Context, name, holder string, ttl time.Duration) error
+	// ReleaseShared 释放持有者占用的位置
+	ReleaseShared(name, holder string) error
+}
+
+// SharedHolderID 生成持有者 id, 供 SharedLocker 实现使用
+func SharedHolderID(owner string) string {
+	return owner + ":" + NewRequestID().Hex()
+}
+
+// sharedLeaser 持有者的续期与释放, 使读写锁与信号量可以使用 Lock 句柄的看门狗
+type sharedLeaser struct {
+	locker SharedLocker
+	holder string
+}
+
+func (l *sharedLeaser) ExtendLock(ctx context.Context, name string, ttl time.Duration) error {
+	return l.locker.ExtendShared(ctx, name, l.holder, ttl)
+}
+
+func (l *sharedLeaser) ReleaseLock(name string) error {
+	return l.locker.ReleaseShared(name, l.holder)
+}
+
+// AcquireShared 加读写锁或信号量并返回锁句柄, 句柄在 Release 前自动续期, Token 为 0
+//
+//	l, err := bkit.AcquireShared(locker, "report", bkit.LockModeRead, 0, 10*time.Second)
+//	defer l.Release(ctx)
+func AcquireShared(locker SharedLocker, name, mode string, permits int, ttl time.Duration, cfg ...*LockConf) (*Lock, error) {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	holder, err := locker.AcquireShared(name, mode, permits, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return NewLock(&sharedLeaser{locker: locker, holder: holder}, name, ttl, 0, cfg...), nil
+}
+
+// Semaphore 分布式计数信号量, 同一个锁名最多 permits 个调用同时持有
+type Semaphore struct {
+	locker  SharedLocker
+	waiter  *LockWaiter
+	name    string
+	permits int
+}
+
+func NewSemaphore(locker SharedLocker, name string, permits int) *Semaphore {
+	if permits < 1 {
+		permits = 1
+	}
+	return &Semaphore{
+		locker:  locker,
+		waiter:  NewLockWaiter(),
+		name:    name,
+		permits: permits,
+	}
+}
+
+func (s *Semaphore) Name() string {
+	return s.name
+}
+
+func (s *Semaphore) Permits() int {
+	return s.permits
+}
+
+// Acquire 获取一个位置, 已满返回 ErrAcquireLockFailed, 通过返回的句柄释放
+func (s *Semaphore) Acquire(ttl time.Duration, cfg ...*LockConf) (*Lock, error) {
+	return AcquireShared(s.locker, s.name, LockModeSemaphore, s.permits, ttl, cfg...)
+}
+
+// AcquireCtx 阻塞获取, lockCfg 与 Acquire 的 cfg 一致用于返回的句柄, 可以为 nil
+func (s *Semaphore) AcquireCtx(ctx context.Context, ttl time.Duration, lockCfg *LockConf, cfg ...*AcquireLockConf) (*Lock, error) {
+	var l *Lock
+	err := s.waiter.Wait(ctx, s.name, func() error {
+		var err error
+		l, err = s.Acquire(ttl, lockCfg)
+		return err
+	}, cfg...)
+	return l, err
+}
+
+var _ SharedLocker = &MysqlDistributedLocker{}
+
+// AcquireRLock 加读锁, 通过返回的句柄释放
+func (lock *MysqlDistributedLocker) AcquireRLock(name string, ttl time.Duration, cfg ...*LockConf) (*Lock, error) {
+	return AcquireShared(lock, name, LockModeRead, 0, ttl, cfg...)
+}
+
+// AcquireWLock 加写锁, 读者持续存在时写者可能一直获取不到
+func (lock *MysqlDistributedLocker) AcquireWLock(name string, ttl time.Duration, cfg ...*LockConf) (*Lock, error) {
+	return AcquireShared(lock, name, LockModeWrite, 0, ttl, cfg...)
+}
+
+// Semaphore 创建计数信号量
+func (lock *MysqlDistributedLocker) Semaphore(name string, permits int) *Semaphore {
+	return NewSemaphore(lock, name, permits)
+}
+
+// SharedLockAdmit 根据其他持有者的 mode 判断是否可以获取, 供 SharedLocker 实现使用
+func SharedLockAdmit(mode string, permits int, holders []string) bool {
+	switch mode {
+	case LockModeRead:
+		for _, m := range holders {
+			if m == LockModeWrite {
+				return false
+			}
+		}
+		return true
+	case LockModeWrite:
+		return len(holders) == 0
+	case LockModeSemaphore:
+		return len(holders) < permits
+	}
+	return false
+}
+
+// AcquireShared 加读写锁或信号量, 返回持有者 id
+func (lock *MysqlDistributedLocker) AcquireShared(name, mode string, permits int, ttl time.Duration) (string, error) {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	holder := SharedHolderID(lock.owner)
+	expire := time.Now().Add(ttl)
+	var (
+		ok  bool
+		err error
+	)
+	start := time.Now()
+	Retry.RetryN(1, time.Second, func() error {
+		ok, err = lock.tryAcquireShared(name, holder, mode, permits, expire)
+		return err
+	})
+	lock.counter.Observe(start, ok, err)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrAcquireLockFailed
+	}
+	lock.mutex.Lock()
+	lock.shared[holder] = _distributedLock{
+		LockName:  name,
+		Owner:     holder,
+		Expire:    expire,
+		CreatedAt: time.Now(),
+		Mode:      mode,
+	}
+	lock.mutex.Unlock()
+	return holder, nil
+}
+
+// tryAcquireShared 每个锁名有一条 owner 为空的哨兵记录, 事务内 FOR UPDATE 哨兵串行化同一个锁名的获取
+func (lock *MysqlDistributedLocker) tryAcquireShared(name, holder, mode string, permits int, expire time.Time) (bool, error) {
+	tx, err := lock.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(fmt.Sprintf(`
+	INSERT IGNORE INTO %s (lock_name, owner, mode, expire, created_at) VALUES (?, '', '', 0, 0)`, lock.holderTable), name); err != nil {
+		return false, err
+	}
+	var sentinel string
+	if err := tx.QueryRow(fmt.Sprintf(`
+	SELECT owner FROM %s WHERE lock_name = ? AND owner = '' FOR UPDATE`, lock.holderTable), name).Scan(&sentinel); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`
+	DELETE FROM %s WHERE lock_name = ? AND owner <> '' AND expire < UNIX_TIMESTAMP()`, lock.holderTable), name); err != nil {
+		return false, err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf(`
+	SELECT mode FROM %s WHERE lock_name = ? AND owner <> ''`, lock.holderTable), name)
+	if err != nil {
+		return false, err
+	}
+	holders, err := scanSharedModes(rows)
+	if err != nil {
+		return false, err
+	}
+	if !SharedLockAdmit(mode, permits, holders) {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`
+	INSERT INTO %s (lock_name, owner, mode, expire, created_at)
+	VALUES (?, ?, ?, ?, UNIX_TIMESTAMP())`, lock.holderTable),
+		name, holder, mode, expire.Unix()); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func scanSharedModes(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	modes := make([]string, 0)
+	for rows.Next() {
+		var mode string
+		if err := rows.Scan(&mode); err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+	return modes, rows.Err()
+}
+
+// ExtendShared 续期持有者
+func (lock *MysqlDistributedLocker) ExtendShared(ctx context.Context, name, holder string, ttl time.Duration) error {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	v, ok := lock.shared[holder]
+	if !ok || v.LockName != name {
+		return ErrLockLost
+	}
+	expire := time.Now().Add(ttl)
+	result, err := lock.db.ExecContext(ctx, fmt.Sprintf(`
+	UPDATE %s SET expire = ? WHERE lock_name = ? AND owner = ? AND expire >= UNIX_TIMESTAMP()`, lock.holderTable),
+		expire.Unix(), name, holder)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// expire 未变化时 affected 也为 0, 再确认一次
+		var n int
+		if err := lock.db.QueryRowContext(ctx, fmt.Sprintf(`
+	SELECT COUNT(*) FROM %s WHERE lock_name = ? AND owner = ? AND expire >= UNIX_TIMESTAMP()`, lock.holderTable),
+			name, holder).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			delete(lock.shared, holder)
+			return ErrLockLost
+		}
+	}
+	v.Expire = expire
+	lock.shared[holder] = v
+	return nil
+}
+
+// ReleaseShared 释放读写锁或信号量的持有者
+func (lock *MysqlDistributedLocker) ReleaseShared(name, holder string) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if v, ok := lock.shared[holder]; !ok || v.LockName != name {
+		return fmt.Errorf("%s lock not found", holder)
+	}
+	var err error
+	Retry.RetryN(1, time.Second, func() error {
+		err = lock.tryReleaseShared(name, holder)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	delete(lock.shared, holder)
+	return nil
+}
+
+func (lock *MysqlDistributedLocker) tryReleaseShared(name, holder string) error {
+	_, err := lock.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE lock_name = ? AND owner = ?", lock.holderTable), name, holder)
+	return err
+}
@@ -0,0 +1,170 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedLockAdmit(t *testing.T) {
+	cases := []struct {
+		mode    string
+		permits int
+		holders []string
+		admit   bool
+	}{
+		{LockModeRead, 0, nil, true},
+		{LockModeRead, 0, []string{LockModeRead, LockModeRead}, true},
+		{LockModeRead, 0, []string{LockModeWrite}, false},
+		{LockModeWrite, 0, nil, true},
+		{LockModeWrite, 0, []string{LockModeRead}, false},
+		{LockModeSemaphore, 2, []string{LockModeSemaphore}, true},
+		{LockModeSemaphore, 2, []string{LockModeSemaphore, LockModeSemaphore}, false},
+		{"x", 0, nil, false},
+	}
+	for i, c := range cases {
+		if SharedLockAdmit(c.mode, c.permits, c.holders) != c.admit {
+			t.Fatalf("case %d should %v", i, c.admit)
+		}
+	}
+}
+
+// testSharedStore 多个 owner 共享的内存存储, 锁名 -> 持有者 id -> mode
+type testSharedStore struct {
+	mutex   sync.Mutex
+	holders map[string]map[string]string
+	extends int
+}
+
+type testSharedLocker struct {
+	store *testSharedStore
+	owner string
+}
+
+func (l *testSharedLocker) AcquireShared(name, mode string, permits int, ttl time.Duration) (string, error) {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+	modes := make([]string, 0)
+	for _, m := range l.store.holders[name] {
+		modes = append(modes, m)
+	}
+	if !SharedLockAdmit(mode, permits, modes) {
+		return "", ErrAcquireLockFailed
+	}
+	if l.store.holders[name] == nil {
+		l.store.holders[name] = make(map[string]string)
+	}
+	holder := SharedHolderID(l.owner)
+	l.store.holders[name][holder] = mode
+	return holder, nil
+}
+
+func (l *testSharedLocker) ExtendShared(ctx context.Context, name, holder string, ttl time.Duration) error {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+	if _, ok := l.store.holders[name][holder]; !ok {
+		return ErrLockLost
+	}
+	l.store.extends++
+	return nil
+}
+
+func (l *testSharedLocker) ReleaseShared(name, holder string) error {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+	delete(l.store.holders[name], holder)
+	return nil
+}
+
+func (s *testSharedStore) count(name string) (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.holders[name]), s.extends
+}
+
+func TestSemaphore(t *testing.T) {
+	store := &testSharedStore{holders: make(map[string]map[string]string)}
+	sems := make([]*Semaphore, 3)
+	for i := range sems {
+		sems[i] = NewSemaphore(&testSharedLocker{store: store, owner: fmt.Sprintf("owner_%d", i)}, "api", 2)
+	}
+	l0, err := sems[0].Acquire(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1, err := sems[1].Acquire(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Release(context.Background())
+	if _, err := sems[2].Acquire(time.Second); err != ErrAcquireLockFailed {
+		t.Fatalf("should full, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = l0.Release(context.Background())
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	l2, err := sems[2].AcquireCtx(ctx, time.Second, &LockConf{RenewInterval: 20 * time.Millisecond},
+		&AcquireLockConf{MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Release(context.Background())
+	// 阻塞获取的句柄同样按 LockConf 续期
+	_, before := store.count("api")
+	waitFor(t, time.Second, func() bool {
+		_, extends := store.count("api")
+		return extends > before
+	}, "blocking acquired holder not renewed")
+}
+
+func TestSemaphore_SameOwner(t *testing.T) {
+	store := &testSharedStore{holders: make(map[string]map[string]string)}
+	sem := NewSemaphore(&testSharedLocker{store: store, owner: "owner"}, "api", 2)
+
+	// 同一个 owner 的每次获取都单独占用一个位置
+	conf := &LockConf{RenewInterval: 20 * time.Millisecond}
+	l0, err := sem.Acquire(time.Second, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1, err := sem.Acquire(time.Second, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sem.Acquire(time.Second); err != ErrAcquireLockFailed {
+		t.Fatalf("should full, got %v", err)
+	}
+
+	// 释放只归还自己的位置
+	if err := l0.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := store.count("api"); n != 1 {
+		t.Fatalf("expect 1 holder, got %d", n)
+	}
+	l2, err := sem.Acquire(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Release(context.Background())
+
+	// 看门狗续期持有者
+	waitFor(t, time.Second, func() bool {
+		_, extends := store.count("api")
+		return extends > 0
+	}, "shared holder not renewed")
+	select {
+	case <-l1.Lost():
+		t.Fatal("holder should not lost")
+	default:
+	}
+	if err := l1.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
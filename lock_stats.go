@@ -0,0 +1,146 @@
+package bkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// lockLatencyBuckets 加锁耗时直方图的桶上界, 1ms ~ 5s
+var lockLatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+}
+
+// LockStats 分布式锁统计, 只统计访问存储的加锁
+type LockStats struct {
+	Acquired  int64 // 获取成功次数
+	Contended int64 // 被其他 owner 持有导致获取失败次数
+	Timeouts  int64 // AcquireLockCtx 等待超时或取消次数
+	Errors    int64 // IO 错误次数
+
+	LatencyBuckets []int64       // 加锁耗时直方图, 1ms ~ 5s 共 11 个桶, 非累计
+	LatencySum     time.Duration // 加锁总耗时
+	LatencyCount   int64         // 加锁次数
+}
+
+// LockStater 提供统计信息的锁
+type LockStater interface {
+	Stats() LockStats
+}
+
+// WriteLockStatsPrometheus 以 Prometheus 文本格式输出锁统计, lockers key 为 label locker 的值
+func WriteLockStatsPrometheus(w io.Writer, namespace string, lockers map[string]LockStater) error {
+	if namespace == "" {
+		namespace = "bkit"
+	}
+	names := make([]string, 0, len(lockers))
+	stats := make(map[string]LockStats, len(lockers))
+	for name, l := range lockers {
+		names = append(names, name)
+		stats[name] = l.Stats()
+	}
+	sort.Strings(names)
+
+	metrics := []struct {
+		name string
+		help string
+		val  func(s LockStats) int64
+	}{
+		{"lock_acquired_total", "Number of locks acquired.", func(s LockStats) int64 { return s.Acquired }},
+		{"lock_contended_total", "Number of acquisitions failed because the lock was held.", func(s LockStats) int64 { return s.Contended }},
+		{"lock_timeouts_total", "Number of blocking acquisitions timed out or canceled.", func(s LockStats) int64 { return s.Timeouts }},
+		{"lock_errors_total", "Number of acquisitions failed with errors.", func(s LockStats) int64 { return s.Errors }},
+	}
+	for _, m := range metrics {
+		name := namespace + "_" + m.name
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, m.help, name); err != nil {
+			return err
+		}
+		for _, l := range names {
+			if _, err := fmt.Fprintf(w, "%s{locker=%q} %d\n", name, l, m.val(stats[l])); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := namespace + "_lock_acquire_duration_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s Latency of lock acquisitions.\n# TYPE %s histogram\n", name, name); err != nil {
+		return err
+	}
+	for _, l := range names {
+		s := stats[l]
+		var cumulative int64
+		for i, le := range lockLatencyBuckets {
+			if i < len(s.LatencyBuckets) {
+				cumulative += s.LatencyBuckets[i]
+			}
+			if _, err := fmt.Fprintf(w, "%s_bucket{locker=%q,le=\"%g\"} %d\n", name, l, le.Seconds(), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{locker=%q,le=\"+Inf\"} %d\n%s_sum{locker=%q} %g\n%s_count{locker=%q} %d\n",
+			name, l, s.LatencyCount, name, l, s.LatencySum.Seconds(), name, l, s.LatencyCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockCounter 锁计数, 并发安全, 供 DistributedLocker 实现使用
+type LockCounter struct {
+	acquired  int64
+	contended int64
+	timeouts  int64
+	errors    int64
+
+	buckets [11]int64
+	sum     int64
+	count   int64
+}
+
+// Observe 记录一次访问存储的加锁, start 为开始时间
+func (c *LockCounter) Observe(start time.Time, ok bool, err error) {
+	d := time.Since(start)
+	for i, le := range lockLatencyBuckets {
+		if d <= le {
+			atomic.AddInt64(&c.buckets[i], 1)
+			break
+		}
+	}
+	atomic.AddInt64(&c.sum, int64(d))
+	atomic.AddInt64(&c.count, 1)
+	switch {
+	case ok:
+		atomic.AddInt64(&c.acquired, 1)
+	case err != nil && !errors.Is(err, ErrAcquireLockFailed):
+		atomic.AddInt64(&c.errors, 1)
+	default:
+		atomic.AddInt64(&c.contended, 1)
+	}
+}
+
+// Timeout 记录一次阻塞加锁超时
+func (c *LockCounter) Timeout() {
+	atomic.AddInt64(&c.timeouts, 1)
+}
+
+func (c *LockCounter) Stats() LockStats {
+	s := LockStats{
+		Acquired:       atomic.LoadInt64(&c.acquired),
+		Contended:      atomic.LoadInt64(&c.contended),
+		Timeouts:       atomic.LoadInt64(&c.timeouts),
+		Errors:         atomic.LoadInt64(&c.errors),
+		LatencyBuckets: make([]int64, len(lockLatencyBuckets)),
+		LatencySum:     time.Duration(atomic.LoadInt64(&c.sum)),
+		LatencyCount:   atomic.LoadInt64(&c.count),
+	}
+	for i := range s.LatencyBuckets {
+		s.LatencyBuckets[i] = atomic.LoadInt64(&c.buckets[i])
+	}
+	return s
+}
@@ -0,0 +1,48 @@
+package bkit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockCounter(t *testing.T) {
+	c := &LockCounter{}
+	c.Observe(time.Now(), true, nil)
+	c.Observe(time.Now(), false, nil)
+	c.Observe(time.Now(), false, ErrAcquireLockFailed)
+	c.Observe(time.Now().Add(-2*time.Second), false, fmt.Errorf("io"))
+	c.Timeout()
+	s := c.Stats()
+	if s.Acquired != 1 || s.Contended != 2 || s.Errors != 1 || s.Timeouts != 1 || s.LatencyCount != 4 {
+		t.Fatalf("stats %+v", s)
+	}
+	if s.LatencyBuckets[0] != 3 || s.LatencyBuckets[9] != 1 {
+		t.Fatalf("buckets %v", s.LatencyBuckets)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteLockStatsPrometheus(buf, "app", map[string]LockStater{"mysql": c}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`app_lock_acquired_total{locker="mysql"} 1`,
+		`app_lock_contended_total{locker="mysql"} 2`,
+		`app_lock_acquire_duration_seconds_bucket{locker="mysql",le="0.001"} 3`,
+		`app_lock_acquire_duration_seconds_bucket{locker="mysql",le="2.5"} 4`,
+		`app_lock_acquire_duration_seconds_bucket{locker="mysql",le="+Inf"} 4`,
+		`app_lock_acquire_duration_seconds_count{locker="mysql"} 4`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("should contains %s\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	if v := likePrefix(`job_1%`); v != `job\_1\%%` {
+		t.Fatal(v)
+	}
+}
@@ -1,6 +1,7 @@
 package bkit
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -46,4 +47,23 @@ func TestMysqlDistributedLocker(t *testing.T) {
 			t.Fatal("AcquireLock 应该获取到锁")
 		}
 	}
+
+	// 其他节点强制释放后, 重入需要重新竞争, token 递增
+	before, err := lock2.Token(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.ForceRelease(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.AcquireLock(key, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	after, err := lock2.Token(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before {
+		t.Fatalf("token should increase after force release, %d <= %d", after, before)
+	}
 }
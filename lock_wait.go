@@ -0,0 +1,157 @@
+package bkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type AcquireLockConf struct {
+	MinBackoff time.Duration // 首次重试间隔, 默认 50ms
+	MaxBackoff time.Duration // 最大重试间隔, 默认 2s
+	Multiplier float64       // 间隔倍数, 默认 2
+	Jitter     float64       // 随机抖动比例 [0, 1], 默认 0.2, 避免多个节点同时重试
+	// Fair 同一个 locker 内按到达顺序排队, 只有队首去存储轮询, 其他等待前一个结束
+	Fair bool
+}
+
+func (c *AcquireLockConf) Validate() error {
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = 50 * time.Millisecond
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = 2 * time.Second
+		if c.MaxBackoff < c.MinBackoff {
+			c.MaxBackoff = c.MinBackoff
+		}
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = 2
+	}
+	if c.Jitter <= 0 || c.Jitter > 1 {
+		c.Jitter = 0.2
+	}
+	return nil
+}
+
+// backoff 第 n 次重试的间隔
+func (c *AcquireLockConf) backoff(n int) time.Duration {
+	d := float64(c.MinBackoff)
+	for i := 0; i < n && d < float64(c.MaxBackoff); i++ {
+		d *= c.Multiplier
+	}
+	if d > float64(c.MaxBackoff) {
+		d = float64(c.MaxBackoff)
+	}
+	d += d * c.Jitter * (rand.Float64()*2 - 1)
+	return time.Duration(d)
+}
+
+// LockWaiter 阻塞加锁, 供 DistributedLocker.AcquireLockCtx 实现使用
+type LockWaiter struct {
+	mutex  sync.Mutex
+	queues map[string][]chan struct{}
+}
+
+func NewLockWaiter() *LockWaiter {
+	return &LockWaiter{
+		queues: make(map[string][]chan struct{}),
+	}
+}
+
+// Wait 循环调用 try 直到成功或 ctx 结束
+// try 返回 ErrAcquireLockFailed 或 IO 错误时退避重试, ctx 结束返回 ctx.Err()
+// 最后一次 try 为 IO 错误时同时包装该错误, errors.Is 可以判断两者
+func (w *LockWaiter) Wait(ctx context.Context, name string, try func() error, cfg ...*AcquireLockConf) error {
+	conf := &AcquireLockConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		c := *cfg[0]
+		conf = &c
+	}
+	_ = conf.Validate()
+
+	if conf.Fair {
+		if err := w.enqueue(ctx, name); err != nil {
+			return err
+		}
+		defer w.dequeue(name)
+	}
+
+	var lastErr error
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for n := 0; ; n++ {
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("%w: %w", ctx.Err(), lastErr)
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+		err := try()
+		if err == nil {
+			return nil
+		}
+		// IO 错误同样继续增大退避, 存储不可用时避免所有等待者按最小间隔重试
+		lastErr = nil
+		if !errors.Is(err, ErrAcquireLockFailed) {
+			lastErr = err
+		}
+		timer.Reset(conf.backoff(n))
+	}
+}
+
+// enqueue 排队直到成为队首
+func (w *LockWaiter) enqueue(ctx context.Context, name string) error {
+	ch := make(chan struct{})
+	w.mutex.Lock()
+	w.queues[name] = append(w.queues[name], ch)
+	if len(w.queues[name]) == 1 {
+		close(ch)
+	}
+	w.mutex.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	select {
+	case <-ch:
+		// 已经是队首, 交给下一个
+		w.next(name)
+	default:
+		q := w.queues[name]
+		for i, v := range q {
+			if v == ch {
+				w.queues[name] = append(q[:i:i], q[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (w *LockWaiter) dequeue(name string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.next(name)
+}
+
+// next 移除队首并唤醒下一个
+func (w *LockWaiter) next(name string) {
+	q := w.queues[name][1:]
+	if len(q) == 0 {
+		delete(w.queues, name)
+		return
+	}
+	w.queues[name] = q
+	close(q[0])
+}
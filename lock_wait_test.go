@@ -0,0 +1,123 @@
+package bkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockConf_backoff(t *testing.T) {
+	c := &AcquireLockConf{MinBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	_ = c.Validate()
+	for n := 0; n < 10; n++ {
+		d := c.backoff(n)
+		if d < 8*time.Millisecond || d > 120*time.Millisecond {
+			t.Fatalf("backoff %d out of range %s", n, d)
+		}
+	}
+	if d := c.backoff(0); d > 12*time.Millisecond {
+		t.Fatalf("first backoff %s", d)
+	}
+}
+
+func TestLockWaiter_Wait(t *testing.T) {
+	w := NewLockWaiter()
+	n := 0
+	err := w.Wait(context.Background(), "key", func() error {
+		n++
+		if n < 3 {
+			return ErrAcquireLockFailed
+		}
+		return nil
+	}, &AcquireLockConf{MinBackoff: time.Millisecond})
+	if err != nil || n != 3 {
+		t.Fatalf("should acquired after 3 tries, %v %d", err, n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = w.Wait(ctx, "key", func() error {
+		return ErrAcquireLockFailed
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("should timeout, got %v", err)
+	}
+
+	// IO 错误继续退避, 结束时返回最后的错误
+	ioErr := fmt.Errorf("store unavailable")
+	tries := 0
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = w.Wait(ctx, "key", func() error {
+		tries++
+		return ioErr
+	}, &AcquireLockConf{MinBackoff: 10 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.01})
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ioErr) {
+		t.Fatalf("should wrap ctx and io error, got %v", err)
+	}
+	if tries > 6 {
+		t.Fatalf("io error should back off, tries %d", tries)
+	}
+}
+
+func TestLockWaiter_Fair(t *testing.T) {
+	w := NewLockWaiter()
+	var (
+		mutex sync.Mutex
+		held  = true
+		order []int
+	)
+	try := func(i int) func() error {
+		return func() error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if held {
+				return ErrAcquireLockFailed
+			}
+			held = true
+			order = append(order, i)
+			return nil
+		}
+	}
+	conf := &AcquireLockConf{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Fair: true}
+
+	// 中途取消的等待者不影响队列
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := context.Background()
+			if i == 2 {
+				c = ctx
+			}
+			if err := w.Wait(c, "key", try(i), conf); err != nil {
+				if i != 2 {
+					t.Error(err)
+				}
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			held = false
+			mutex.Unlock()
+		}(i)
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	mutex.Lock()
+	held = false
+	mutex.Unlock()
+	wg.Wait()
+
+	if len(order) != 4 || order[0] != 0 || order[1] != 1 || order[2] != 3 || order[3] != 4 {
+		t.Fatalf("should acquire in arrival order, got %v", order)
+	}
+	if len(w.queues) != 0 {
+		t.Fatal("queue should empty")
+	}
+}
@@ -0,0 +1,135 @@
+package mgo
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"git.woa.com/csm/fault_track/pkg/bkit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type _cacheInvalidateEvent struct {
+	bkit.CacheInvalidateEvent `bson:",inline"`
+	CreatedAt                 time.Time `bson:"created_at"`
+}
+
+var _ bkit.CacheInvalidateTransport = &MongoInvalidateTransport{}
+
+// MongoInvalidateTransport 基于 change streams 的缓存失效传输, 需要副本集或分片集群
+// 事件写入集合, 订阅者 watch insert, 断线后通过 resume token 续接
+type MongoInvalidateTransport struct {
+	db         *Database
+	collection string
+
+	mutex   sync.Mutex
+	cancels []func()
+	wg      sync.WaitGroup
+}
+
+// NewMongoInvalidateTransport collection 为空默认 _cache_invalidate, 事件保留 1 小时, db 由调用方管理
+func NewMongoInvalidateTransport(db *Database, collection string) (*MongoInvalidateTransport, error) {
+	if collection == "" {
+		collection = "_cache_invalidate"
+	}
+	t := &MongoInvalidateTransport{
+		db:         db,
+		collection: collection,
+	}
+	if err := db.CreateIndexes([]Index{
+		{
+			Collection: collection,
+			Name:       "ttl_created_at",
+			Keys: []primitive.E{
+				{Key: "created_at", Value: 1},
+			},
+			ExpireAfterSeconds: 3600,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *MongoInvalidateTransport) Publish(ctx context.Context, event bkit.CacheInvalidateEvent) error {
+	_, err := t.db.Collection(t.collection).InsertOne(ctx, _cacheInvalidateEvent{
+		CacheInvalidateEvent: event,
+		CreatedAt:            time.Now(),
+	})
+	return err
+}
+
+func (t *MongoInvalidateTransport) watch(ctx context.Context, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+	}
+	opt := options.ChangeStream()
+	if resumeToken != nil {
+		opt.SetResumeAfter(resumeToken)
+	}
+	return t.db.Collection(t.collection).Watch(ctx, pipeline, opt)
+}
+
+func (t *MongoInvalidateTransport) Subscribe(ctx context.Context, fn func(event bkit.CacheInvalidateEvent)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := t.watch(ctx, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	t.mutex.Lock()
+	t.cancels = append(t.cancels, cancel)
+	t.mutex.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		for {
+			for stream.Next(ctx) {
+				v := struct {
+					FullDocument _cacheInvalidateEvent `bson:"fullDocument"`
+				}{}
+				if err := stream.Decode(&v); err != nil {
+					log.Printf("WARNING: cache invalidate event decode %s\n", err.Error())
+					continue
+				}
+				fn(v.FullDocument.CacheInvalidateEvent)
+			}
+			resumeToken := stream.ResumeToken()
+			err := stream.Err()
+			_ = stream.Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("WARNING: cache invalidate change stream %v, resume\n", err)
+			// 续接失败时重试
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				if stream, err = t.watch(ctx, resumeToken); err == nil {
+					break
+				}
+				log.Printf("WARNING: cache invalidate change stream watch %s\n", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *MongoInvalidateTransport) Close() error {
+	t.mutex.Lock()
+	for _, cancel := range t.cancels {
+		cancel()
+	}
+	t.cancels = nil
+	t.mutex.Unlock()
+	t.wg.Wait()
+	return nil
+}
@@ -19,16 +19,24 @@ type _distributedLock struct {
 	Expire    time.Time `bson:"expire"`
 	CreatedAt time.Time `bson:"created_at"`
 	Ver       string    `bson:"ver"`
+	Token     int64     `bson:"token"`          // fencing token, 每次获取加 1
+	Mode      string    `bson:"mode,omitempty"` // 读写锁与信号量的模式
 }
 
+var _ bkit.DistributedLocker = &MongoDistributedLocker{}
+
 // 通过MongoDB 实现的分布式锁
 type MongoDistributedLocker struct {
-	db         *Database
-	collection string
-	owner      string
+	db               *Database
+	collection       string
+	holderCollection string
+	owner            string
+	waiter           *bkit.LockWaiter
+	counter          bkit.LockCounter
 
-	mutex sync.Mutex
-	m     map[string]_distributedLock
+	mutex  sync.Mutex
+	m      map[string]_distributedLock
+	shared map[string]_distributedLock // 持有者 id -> 读写锁与信号量
 }
 
 // NewMongoDistributedLocker 创建一个基于MongoDB的分布式锁, 适用于不太频繁的场景
@@ -39,10 +47,13 @@ func NewMongoDistributedLocker(ctx context.Context, conn DBConn, owner string) (
 	}
 
 	lock := &MongoDistributedLocker{
-		db:         db,
-		collection: "_distributed_locks",
-		owner:      owner,
-		m:          make(map[string]_distributedLock),
+		db:               db,
+		collection:       "_distributed_locks",
+		holderCollection: "_distributed_lock_holders",
+		owner:            owner,
+		waiter:           bkit.NewLockWaiter(),
+		m:                make(map[string]_distributedLock),
+		shared:           make(map[string]_distributedLock),
 	}
 
 	// 创建索引
@@ -55,6 +66,15 @@ func NewMongoDistributedLocker(ctx context.Context, conn DBConn, owner string) (
 			},
 			Unique: true,
 		},
+		{
+			Collection: lock.holderCollection,
+			Name:       "unique_lock_name_owner",
+			Keys: []primitive.E{
+				{Key: "lock_name", Value: 1},
+				{Key: "owner", Value: 1},
+			},
+			Unique: true,
+		},
 	}); err != nil {
 		return nil, err
 	}
@@ -71,6 +91,11 @@ func (lock *MongoDistributedLocker) Close() error {
 
 // AcquireLock 加锁
 func (lock *MongoDistributedLocker) AcquireLock(name string, ttl time.Duration) error {
+	return lock.acquireLock(name, ttl, true)
+}
+
+// acquireLock reentrant=false 时本地已持有返回 ErrAcquireLockFailed
+func (lock *MongoDistributedLocker) acquireLock(name string, ttl time.Duration, reentrant bool) error {
 	if ttl < time.Second {
 		ttl = time.Second
 	}
@@ -80,25 +105,41 @@ func (lock *MongoDistributedLocker) AcquireLock(name string, ttl time.Duration)
 	// 先本地判断是否已经加锁
 	if v, ok := lock.m[name]; ok {
 		if v.Expire.After(time.Now()) {
-			return nil
+			if !reentrant {
+				return bkit.ErrAcquireLockFailed
+			}
+			// 本地记录可能已被其他节点 ForceRelease, 到存储确认
+			held, err := lock.stillHeld(v)
+			if err != nil {
+				return err
+			}
+			if held {
+				return nil
+			}
 		}
-		// 过期了, 删除
+		// 过期或已被强制释放, 删除
 		delete(lock.m, name)
 	}
 	expire := time.Now().Local().Add(ttl)
 	// 本地没有, 则去数据库获取锁
 	var (
-		ok  bool
-		err error
+		ok    bool
+		token int64
+		err   error
 	)
 
+	start := time.Now()
 	bkit.Retry.RetryN(1, 100*time.Millisecond, func() error {
-		ok, err = lock.tryAcquireLock(name, expire)
+		token, ok, err = lock.tryAcquireLock(name, expire)
 		if err != nil {
 			return err
 		}
 		return nil
 	})
+	lock.counter.Observe(start, ok, err)
+	if err != nil {
+		return err
+	}
 
 	if ok {
 		lock.m[name] = _distributedLock{
@@ -106,14 +147,30 @@ func (lock *MongoDistributedLocker) AcquireLock(name string, ttl time.Duration)
 			Owner:     lock.owner,
 			Expire:    expire,
 			CreatedAt: time.Now().Local(),
+			Token:     token,
 		}
 		return nil
 	}
 	return bkit.ErrAcquireLockFailed
 }
 
-func (lock *MongoDistributedLocker) tryAcquireLock(name string, expire time.Time) (bool, error) {
+// stillHeld 存储中仍是自己持有且 token 未变化
+func (lock *MongoDistributedLocker) stillHeld(v _distributedLock) (bool, error) {
+	n, err := lock.db.Collection(lock.collection).CountDocuments(context.Background(), bson.M{
+		"lock_name": v.LockName,
+		"owner":     lock.owner,
+		"token":     v.Token,
+		"expire":    bson.M{"$gte": time.Now().Local()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (lock *MongoDistributedLocker) tryAcquireLock(name string, expire time.Time) (int64, bool, error) {
 	isLock := false
+	var token int64
 
 	err := lock.db.Transaction(context.Background(), func(session SessionContext) error {
 		doc := &_distributedLock{}
@@ -127,6 +184,7 @@ func (lock *MongoDistributedLocker) tryAcquireLock(name string, expire time.Time
 			Expire:    expire,
 			CreatedAt: time.Now().Local(),
 			Ver:       fmt.Sprintf("%d", time.Now().UnixNano()),
+			Token:     1,
 		}
 		if !exists {
 			_, err := lock.db.Collection(lock.collection).InsertOne(session, v)
@@ -139,6 +197,7 @@ func (lock *MongoDistributedLocker) tryAcquireLock(name string, expire time.Time
 			}
 			// 获取锁成功
 			isLock = true
+			token = v.Token
 			return nil
 		}
 
@@ -158,6 +217,7 @@ func (lock *MongoDistributedLocker) tryAcquireLock(name string, expire time.Time
 				"created_at": time.Now().Local(),
 				"ver":        v.Ver,
 			},
+			"$inc": bson.M{"token": 1},
 		}
 		// 已经过期, 去更新
 		ret, err := lock.db.Collection(lock.collection).UpdateOne(session, filter, up)
@@ -171,11 +231,83 @@ func (lock *MongoDistributedLocker) tryAcquireLock(name string, expire time.Time
 		if ret.ModifiedCount > 0 {
 			// 更新成功
 			isLock = true
+			token = doc.Token + 1
 		}
 		return nil
 	})
 
-	return isLock, err
+	return token, isLock, err
+}
+
+// AcquireLockCtx 阻塞加锁
+func (lock *MongoDistributedLocker) AcquireLockCtx(ctx context.Context, name string, ttl time.Duration, cfg ...*bkit.AcquireLockConf) error {
+	err := lock.waiter.Wait(ctx, name, func() error {
+		return lock.acquireLock(name, ttl, false)
+	}, cfg...)
+	if err != nil && ctx.Err() != nil {
+		lock.counter.Timeout()
+	}
+	return err
+}
+
+// Acquire 加锁并返回锁句柄
+func (lock *MongoDistributedLocker) Acquire(ctx context.Context, name string, ttl time.Duration, cfg ...*bkit.LockConf) (*bkit.Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	if err := lock.acquireLock(name, ttl, false); err != nil {
+		return nil, err
+	}
+	token, err := lock.Token(name)
+	if err != nil {
+		return nil, err
+	}
+	return bkit.NewLock(lock, name, ttl, token, cfg...), nil
+}
+
+// Token 当前持有锁的 fencing token
+func (lock *MongoDistributedLocker) Token(name string) (int64, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	v, ok := lock.m[name]
+	if !ok || !v.Expire.After(time.Now()) {
+		return 0, bkit.ErrLockLost
+	}
+	return v.Token, nil
+}
+
+// ExtendLock 续期
+func (lock *MongoDistributedLocker) ExtendLock(ctx context.Context, name string, ttl time.Duration) error {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	v, ok := lock.m[name]
+	if !ok {
+		return bkit.ErrLockLost
+	}
+	expire := time.Now().Local().Add(ttl)
+	filter := bson.M{
+		"lock_name": name,
+		"owner":     lock.owner,
+		"expire":    bson.M{"$gt": time.Now().Local()},
+	}
+	ret, err := lock.db.Collection(lock.collection).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"expire": expire}})
+	if err != nil {
+		return err
+	}
+	if ret.MatchedCount == 0 {
+		delete(lock.m, name)
+		return bkit.ErrLockLost
+	}
+	v.Expire = expire
+	lock.m[name] = v
+	return nil
 }
 
 // ReleaseLock 释放锁
@@ -205,7 +337,10 @@ func (lock *MongoDistributedLocker) tryRelease(v _distributedLock) error {
 		"lock_name": v.LockName,
 		"owner":     lock.owner,
 	}
-	_, err := lock.db.Collection(lock.collection).DeleteOne(context.TODO(), filter)
+	// 保留记录使 token 继续递增, 只置为过期
+	_, err := lock.db.Collection(lock.collection).UpdateOne(context.TODO(), filter, bson.M{
+		"$set": bson.M{"expire": time.Unix(0, 0)},
+	})
 	return err
 }
 
@@ -221,5 +356,11 @@ func (lock *MongoDistributedLocker) ReleaseAllLocks() error {
 		}
 	}
 	lock.m = make(map[string]_distributedLock)
+	for holder, v := range lock.shared {
+		if err := lock.tryReleaseShared(v.LockName, holder); err != nil {
+			return err
+		}
+	}
+	lock.shared = make(map[string]_distributedLock)
 	return nil
 }
@@ -0,0 +1,93 @@
+package mgo
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"time"
+
+	"git.woa.com/csm/fault_track/pkg/bkit"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var _ bkit.LockAdmin = &MongoDistributedLocker{}
+var _ bkit.LockStater = &MongoDistributedLocker{}
+
+// Stats 加锁统计
+func (lock *MongoDistributedLocker) Stats() bkit.LockStats {
+	return lock.counter.Stats()
+}
+
+// ListLocks 列出未过期的持有者
+func (lock *MongoDistributedLocker) ListLocks(ctx context.Context, prefix string) ([]bkit.LockInfo, error) {
+	filter := bson.M{
+		"lock_name": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+		"owner":     bson.M{"$ne": ""},
+		"expire":    bson.M{"$gte": time.Now().Local()},
+	}
+	infos := make([]bkit.LockInfo, 0)
+	for _, collection := range []string{lock.collection, lock.holderCollection} {
+		docs := make([]_distributedLock, 0)
+		if err := lock.db.Find(ctx, collection, filter, &docs); err != nil {
+			return nil, err
+		}
+		for _, v := range docs {
+			infos = append(infos, bkit.LockInfo{
+				Name:      v.LockName,
+				Owner:     v.Owner,
+				Mode:      v.Mode,
+				Expire:    v.Expire,
+				CreatedAt: v.CreatedAt,
+				Token:     v.Token,
+			})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Owner < infos[j].Owner
+	})
+	return infos, nil
+}
+
+// ForceRelease 强制释放互斥锁与读写锁/信号量的所有持有者
+func (lock *MongoDistributedLocker) ForceRelease(ctx context.Context, name string) error {
+	if _, err := lock.db.Collection(lock.collection).UpdateOne(ctx, bson.M{"lock_name": name},
+		bson.M{"$set": bson.M{"expire": time.Unix(0, 0)}}); err != nil {
+		return err
+	}
+	if _, err := lock.db.Collection(lock.holderCollection).DeleteMany(ctx, bson.M{
+		"lock_name": name,
+		"owner":     bson.M{"$ne": ""},
+	}); err != nil {
+		return err
+	}
+	lock.mutex.Lock()
+	delete(lock.m, name)
+	for holder, v := range lock.shared {
+		if v.LockName == name {
+			delete(lock.shared, holder)
+		}
+	}
+	lock.mutex.Unlock()
+	return nil
+}
+
+// ReapExpired 清理过期持有者, 互斥锁的记录保留用于 token 递增, 只清空 owner
+func (lock *MongoDistributedLocker) ReapExpired(ctx context.Context) (int64, error) {
+	filter := bson.M{
+		"owner":  bson.M{"$ne": ""},
+		"expire": bson.M{"$lt": time.Now().Local()},
+	}
+	ret, err := lock.db.Collection(lock.collection).UpdateMany(ctx, filter, bson.M{"$set": bson.M{"owner": ""}})
+	if err != nil {
+		return 0, err
+	}
+	n := ret.ModifiedCount
+	del, err := lock.db.Collection(lock.holderCollection).DeleteMany(ctx, filter)
+	if err != nil {
+		return n, err
+	}
+	return n + del.DeletedCount, nil
+}
@@ -0,0 +1,178 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"git.woa.com/csm/fault_track/pkg/bkit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ bkit.SharedLocker = &MongoDistributedLocker{}
+
+// AcquireRLock 加读锁, 通过返回的句柄释放
+func (lock *MongoDistributedLocker) AcquireRLock(name string, ttl time.Duration, cfg ...*bkit.LockConf) (*bkit.Lock, error) {
+	return bkit.AcquireShared(lock, name, bkit.LockModeRead, 0, ttl, cfg...)
+}
+
+// AcquireWLock 加写锁, 读者持续存在时写者可能一直获取不到
+func (lock *MongoDistributedLocker) AcquireWLock(name string, ttl time.Duration, cfg ...*bkit.LockConf) (*bkit.Lock, error) {
+	return bkit.AcquireShared(lock, name, bkit.LockModeWrite, 0, ttl, cfg...)
+}
+
+// Semaphore 创建计数信号量
+func (lock *MongoDistributedLocker) Semaphore(name string, permits int) *bkit.Semaphore {
+	return bkit.NewSemaphore(lock, name, permits)
+}
+
+// AcquireShared 加读写锁或信号量, 返回持有者 id
+func (lock *MongoDistributedLocker) AcquireShared(name, mode string, permits int, ttl time.Duration) (string, error) {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	holder := bkit.SharedHolderID(lock.owner)
+	expire := time.Now().Local().Add(ttl)
+	var (
+		ok  bool
+		err error
+	)
+	start := time.Now()
+	bkit.Retry.RetryN(1, 100*time.Millisecond, func() error {
+		ok, err = lock.tryAcquireShared(name, holder, mode, permits, expire)
+		return err
+	})
+	lock.counter.Observe(start, ok, err)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", bkit.ErrAcquireLockFailed
+	}
+	lock.mutex.Lock()
+	lock.shared[holder] = _distributedLock{
+		LockName:  name,
+		Owner:     holder,
+		Expire:    expire,
+		CreatedAt: time.Now().Local(),
+		Mode:      mode,
+	}
+	lock.mutex.Unlock()
+	return holder, nil
+}
+
+// tryAcquireShared 事务内先更新 owner 为空的哨兵文档, 同一个锁名的并发获取写冲突, 只有一个能提交
+func (lock *MongoDistributedLocker) tryAcquireShared(name, holder, mode string, permits int, expire time.Time) (bool, error) {
+	isLock := false
+	coll := lock.db.Collection(lock.holderCollection)
+	err := lock.db.Transaction(context.Background(), func(session SessionContext) error {
+		if _, err := coll.UpdateOne(session, bson.M{"lock_name": name, "owner": ""},
+			bson.M{"$inc": bson.M{"seq": 1}}, options.Update().SetUpsert(true)); err != nil {
+			return err
+		}
+		if _, err := coll.DeleteMany(session, bson.M{
+			"lock_name": name,
+			"owner":     bson.M{"$ne": ""},
+			"expire":    bson.M{"$lt": time.Now().Local()},
+		}); err != nil {
+			return err
+		}
+
+		docs := make([]_distributedLock, 0)
+		if err := lock.db.Find(session, lock.holderCollection, bson.M{
+			"lock_name": name,
+			"owner":     bson.M{"$ne": ""},
+		}, &docs); err != nil {
+			return err
+		}
+		holders := make([]string, 0, len(docs))
+		for _, v := range docs {
+			holders = append(holders, v.Mode)
+		}
+		if !bkit.SharedLockAdmit(mode, permits, holders) {
+			return nil
+		}
+
+		if _, err := coll.InsertOne(session, _distributedLock{
+			LockName:  name,
+			Owner:     holder,
+			Mode:      mode,
+			Expire:    expire,
+			CreatedAt: time.Now().Local(),
+		}); err != nil {
+			return err
+		}
+		isLock = true
+		return nil
+	})
+	if err != nil {
+		var se mongo.ServerError
+		if errors.As(err, &se) && se.HasErrorLabel("TransientTransactionError") {
+			// 写冲突, 其他节点正在获取
+			return false, nil
+		}
+		return false, err
+	}
+	return isLock, nil
+}
+
+// ExtendShared 续期持有者
+func (lock *MongoDistributedLocker) ExtendShared(ctx context.Context, name, holder string, ttl time.Duration) error {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	v, ok := lock.shared[holder]
+	if !ok || v.LockName != name {
+		return bkit.ErrLockLost
+	}
+	expire := time.Now().Local().Add(ttl)
+	ret, err := lock.db.Collection(lock.holderCollection).UpdateOne(ctx, bson.M{
+		"lock_name": name,
+		"owner":     holder,
+		"expire":    bson.M{"$gt": time.Now().Local()},
+	}, bson.M{"$set": bson.M{"expire": expire}})
+	if err != nil {
+		return err
+	}
+	if ret.MatchedCount == 0 {
+		delete(lock.shared, holder)
+		return bkit.ErrLockLost
+	}
+	v.Expire = expire
+	lock.shared[holder] = v
+	return nil
+}
+
+// ReleaseShared 释放读写锁或信号量的持有者
+func (lock *MongoDistributedLocker) ReleaseShared(name, holder string) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if v, ok := lock.shared[holder]; !ok || v.LockName != name {
+		return fmt.Errorf("%s lock not found", holder)
+	}
+	var err error
+	bkit.Retry.RetryN(1, 100*time.Millisecond, func() error {
+		err = lock.tryReleaseShared(name, holder)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	delete(lock.shared, holder)
+	return nil
+}
+
+func (lock *MongoDistributedLocker) tryReleaseShared(name, holder string) error {
+	_, err := lock.db.Collection(lock.holderCollection).DeleteOne(context.TODO(), bson.M{
+		"lock_name": name,
+		"owner":     holder,
+	})
+	return err
+}
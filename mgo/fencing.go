@@ -0,0 +1,21 @@
+package mgo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FencingFilter 在 filter 上追加 field <= token 的条件, 字段不存在视为未写入过
+// 更新时需要同时 $set field 为 token, MatchedCount 为 0 表示 token 已过期
+//
+//	filter := FencingFilter(bson.M{"_id": id}, "fence_token", lock.Token())
+//	update := bson.M{"$set": bson.M{"status": 2, "fence_token": lock.Token()}}
+func FencingFilter(filter bson.M, field string, token int64) bson.M {
+	cond := bson.M{"$or": bson.A{
+		bson.M{field: bson.M{"$lte": token}},
+		bson.M{field: bson.M{"$exists": false}},
+	}}
+	if len(filter) == 0 {
+		return cond
+	}
+	return bson.M{"$and": bson.A{filter, cond}}
+}
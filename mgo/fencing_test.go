@@ -0,0 +1,19 @@
+package mgo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFencingFilter(t *testing.T) {
+	filter := FencingFilter(nil, "fence_token", 5)
+	if _, ok := filter["$or"]; !ok {
+		t.Fatal("empty filter should only fencing condition")
+	}
+	filter = FencingFilter(bson.M{"_id": 1}, "fence_token", 5)
+	and, ok := filter["$and"].(bson.A)
+	if !ok || len(and) != 2 {
+		t.Fatalf("filter %v", filter)
+	}
+}
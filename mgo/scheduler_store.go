@@ -0,0 +1,168 @@
+package mgo
+
+import (
+	"context"
+	"time"
+
+	"git.woa.com/csm/fault_track/pkg/bkit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ bkit.SchedulerStore = &MongoSchedulerStore{}
+
+// MongoSchedulerStore 基于 MongoDB 的调度存储
+type MongoSchedulerStore struct {
+	db            *Database
+	jobCollection string
+	runCollection string
+}
+
+// NewMongoSchedulerStore 创建集合 _scheduler_jobs 与 _scheduler_runs 的索引, db 由调用方管理
+func NewMongoSchedulerStore(db *Database) (*MongoSchedulerStore, error) {
+	s := &MongoSchedulerStore{
+		db:            db,
+		jobCollection: "_scheduler_jobs",
+		runCollection: "_scheduler_runs",
+	}
+	if err := db.CreateIndexes([]Index{
+		{
+			// job_id + scheduled_at 唯一, 插入成功的节点获得执行权
+			Collection: s.runCollection,
+			Name:       "unique_job_id_scheduled_at",
+			Keys: []primitive.E{
+				{Key: "job_id", Value: 1},
+				{Key: "scheduled_at", Value: 1},
+			},
+			Unique: true,
+		},
+		{
+			Collection: s.runCollection,
+			Name:       "status_lease_expire",
+			Keys: []primitive.E{
+				{Key: "status", Value: 1},
+				{Key: "lease_expire", Value: 1},
+			},
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MongoSchedulerStore) SaveJob(ctx context.Context, def bkit.JobDef) error {
+	_, err := s.db.Collection(s.jobCollection).ReplaceOne(ctx, bson.M{"_id": def.ID}, def, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoSchedulerStore) ListJobs(ctx context.Context) ([]bkit.JobDef, error) {
+	defs := make([]bkit.JobDef, 0)
+	if err := s.db.Find(ctx, s.jobCollection, bson.M{}, &defs, options.Find().SetSort(bson.M{"_id": 1})); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// ClaimRun 先插入, 唯一索引冲突时更新可接管的记录
+func (s *MongoSchedulerStore) ClaimRun(ctx context.Context, run *bkit.JobRun) (bool, error) {
+	doc := *run
+	doc.Attempt = 1
+	doc.Status = bkit.JobRunRunning
+	_, err := s.db.Collection(s.runCollection).InsertOne(ctx, doc)
+	if err == nil {
+		run.Attempt, run.Status = doc.Attempt, doc.Status
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	claimed := bkit.JobRun{}
+	err = s.db.Collection(s.runCollection).FindOneAndUpdate(ctx, bson.M{
+		"job_id":       run.JobID,
+		"scheduled_at": run.ScheduledAt,
+		"status":       bson.M{"$in": bson.A{bkit.JobRunRunning, bkit.JobRunRetrying}},
+		"lease_expire": bson.M{"$lte": time.Now()},
+	}, bson.M{
+		"$set": bson.M{
+			"owner":        run.Owner,
+			"status":       bkit.JobRunRunning,
+			"error":        "",
+			"lease_expire": run.LeaseExpire,
+			"started_at":   run.StartedAt,
+			"finished_at":  time.Time{},
+		},
+		"$inc": bson.M{"attempt": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&claimed)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	run.Attempt, run.Status = claimed.Attempt, claimed.Status
+	return true, nil
+}
+
+func (s *MongoSchedulerStore) ExtendRun(ctx context.Context, run *bkit.JobRun) error {
+	res, err := s.db.Collection(s.runCollection).UpdateOne(ctx, bson.M{
+		"job_id":       run.JobID,
+		"scheduled_at": run.ScheduledAt,
+		"owner":        run.Owner,
+		"attempt":      run.Attempt,
+		"status":       bkit.JobRunRunning,
+	}, bson.M{"$set": bson.M{"lease_expire": run.LeaseExpire}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return bkit.ErrLockLost
+	}
+	return nil
+}
+
+func (s *MongoSchedulerStore) FinishRun(ctx context.Context, run *bkit.JobRun) error {
+	res, err := s.db.Collection(s.runCollection).UpdateOne(ctx, bson.M{
+		"job_id":       run.JobID,
+		"scheduled_at": run.ScheduledAt,
+		"owner":        run.Owner,
+		"attempt":      run.Attempt,
+	}, bson.M{"$set": bson.M{
+		"status":       run.Status,
+		"error":        run.Error,
+		"lease_expire": run.LeaseExpire,
+		"finished_at":  run.FinishedAt,
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return bkit.ErrLockLost
+	}
+	return nil
+}
+
+func (s *MongoSchedulerStore) DueRuns(ctx context.Context, now time.Time) ([]bkit.JobRun, error) {
+	runs := make([]bkit.JobRun, 0)
+	if err := s.db.Find(ctx, s.runCollection, bson.M{
+		"status":       bson.M{"$in": bson.A{bkit.JobRunRunning, bkit.JobRunRetrying}},
+		"lease_expire": bson.M{"$lte": now},
+	}, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (s *MongoSchedulerStore) ListRuns(ctx context.Context, jobID string, limit int) ([]bkit.JobRun, error) {
+	opt := options.Find().SetSort(bson.M{"scheduled_at": -1})
+	if limit > 0 {
+		opt.SetLimit(int64(limit))
+	}
+	runs := make([]bkit.JobRun, 0)
+	if err := s.db.Find(ctx, s.runCollection, bson.M{"job_id": jobID}, &runs, opt); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -3,17 +3,30 @@ package bkit
 import (
 	"context"
 	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
 )
 
+// RateLimiter 按 key 限流, key 未注册时不限流
+type RateLimiter interface {
+	// Register 注册限流器, r 为每秒请求数, b 为桶的容量(短时间内允许的最大请求数), 重复注册更新 r 与 b
+	Register(key string, r, b int)
+	// Allow 是否允许通过
+	Allow(key string) bool
+	// Wait 等待直到有请求可以通过
+	Wait(ctx context.Context, key string) error
+}
+
+var _ RateLimiter = &LimiterUtil{}
+
 var Limiter *LimiterUtil
 
 func init() {
 	Limiter = NewLimiterUtil()
 }
 
-// LimiterUtil 限流器
+// LimiterUtil 进程内限流器, 多副本时每个副本独立计数, 需要全局配额使用 RedisRateLimiter
 type LimiterUtil struct {
 	mutex sync.RWMutex
 
@@ -59,11 +72,106 @@ func (lim *LimiterUtil) Allow(key string) bool {
 // Wait 等待直到有请求可以通过
 func (lim *LimiterUtil) Wait(ctx context.Context, key string) error {
 	lim.mutex.RLock()
-	defer lim.mutex.RUnlock()
-
 	limiter, ok := lim.limiterMap[key]
+	lim.mutex.RUnlock()
 	if !ok {
 		return nil
 	}
 	return limiter.Wait(ctx)
 }
+
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Limit      int // 桶的容量
+	Allowed    bool
+	Remaining  int           // 通过后桶内剩余的请求数
+	RetryAfter time.Duration // 未通过时距离下一次可以通过的时间
+	ResetAfter time.Duration // 距离桶恢复满的时间
+}
+
+// RateLimitTaker 按请求动态生成 key 的限流, 例如按客户端限流, 返回结果用于输出 RateLimit 头
+type RateLimitTaker interface {
+	// Take 按 r 与 b 对 key 限流一次, key 不需要注册
+	Take(ctx context.Context, key string, r, b int) (RateLimitResult, error)
+}
+
+var _ RateLimitTaker = &MemoryRateLimiter{}
+
+type memoryRateEntry struct {
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+// MemoryRateLimiter 进程内按 key 限流, 空闲且桶已恢复满的 key 被回收, 回收不改变限流结果
+type MemoryRateLimiter struct {
+	idle time.Duration
+
+	mutex     sync.Mutex
+	m         map[string]*memoryRateEntry
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimiter idle 为 key 的空闲回收时间, 默认 10m
+func NewMemoryRateLimiter(idle time.Duration) *MemoryRateLimiter {
+	if idle <= 0 {
+		idle = 10 * time.Minute
+	}
+	return &MemoryRateLimiter{
+		idle:      idle,
+		m:         make(map[string]*memoryRateEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (lim *MemoryRateLimiter) Take(ctx context.Context, key string, r, b int) (RateLimitResult, error) {
+	now := time.Now()
+	lim.mutex.Lock()
+	lim.sweep(now)
+	v, ok := lim.m[key]
+	if !ok {
+		v = &memoryRateEntry{limiter: rate.NewLimiter(rate.Limit(r), b)}
+		lim.m[key] = v
+	}
+	v.last = now
+	lim.mutex.Unlock()
+
+	limiter := v.limiter
+	if limiter.Limit() != rate.Limit(r) {
+		limiter.SetLimitAt(now, rate.Limit(r))
+	}
+	if limiter.Burst() != b {
+		limiter.SetBurstAt(now, b)
+	}
+	res := RateLimitResult{Limit: b, Allowed: limiter.AllowN(now, 1)}
+	tokens := limiter.TokensAt(now)
+	if res.Allowed && tokens > 0 {
+		res.Remaining = int(tokens)
+	}
+	if r > 0 {
+		if !res.Allowed {
+			res.RetryAfter = time.Duration((1 - tokens) / float64(r) * float64(time.Second))
+		}
+		res.ResetAfter = time.Duration((float64(b) - tokens) / float64(r) * float64(time.Second))
+	}
+	return res, nil
+}
+
+// sweep 每 idle/2 检查一次, 调用方持有锁
+func (lim *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(lim.lastSweep) < lim.idle/2 {
+		return
+	}
+	lim.lastSweep = now
+	for k, v := range lim.m {
+		if now.Sub(v.last) > lim.idle && v.limiter.TokensAt(now) >= float64(v.limiter.Burst()) {
+			delete(lim.m, k)
+		}
+	}
+}
+
+// Len 当前 key 数量
+func (lim *MemoryRateLimiter) Len() int {
+	lim.mutex.Lock()
+	defer lim.mutex.Unlock()
+	return len(lim.m)
+}
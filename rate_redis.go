@@ -0,0 +1,206 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GCRA, key 保存理论到达时间 tat, 时间取 redis TIME 避免副本间时钟偏差
+// 返回 {allowed, remaining, retry_after, reset_after}, 时间为秒的字符串, 避免 lua number 被截断为整数
+var redisRateGCRAScript = redis.NewScript(`
+redis.replicate_commands()
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local emission_interval = 1 / rate
+local burst_offset = emission_interval * burst
+local now = redis.call('TIME')
+now = (now[1] - 1600000000) + (now[2] / 1000000)
+local tat = redis.call('GET', KEYS[1])
+if not tat then
+	tat = now
+else
+	tat = math.max(tonumber(tat), now)
+end
+local new_tat = tat + emission_interval
+local diff = now - (new_tat - burst_offset)
+if diff < 0 then
+	return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+local reset_after = new_tat - now
+redis.call('SET', KEYS[1], tostring(new_tat), 'EX', math.ceil(reset_after))
+return {1, math.floor(diff / emission_interval), '0', tostring(reset_after)}`)
+
+type RedisRateLimiterConf struct {
+	Prefix string // key 前缀, 默认 bkit:rate:
+	// Timeout 单次请求超时, 默认 200ms, 超时按出错处理
+	// 默认放行时 redis 变慢或网络抖动会使超时的请求全部放行, 限流失效, 需要严格限流时开启 FailClosed 或适当调大
+	Timeout    time.Duration
+	FailClosed bool // redis 出错时拒绝请求, 默认放行
+}
+
+func (c *RedisRateLimiterConf) Validate() error {
+	if c.Prefix == "" {
+		c.Prefix = "bkit:rate:"
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 200 * time.Millisecond
+	}
+	return nil
+}
+
+type rateLimit struct {
+	r, b int
+}
+
+var (
+	_ RateLimiter    = &RedisRateLimiter{}
+	_ RateLimitTaker = &RedisRateLimiter{}
+)
+
+// RedisRateLimiter 基于 redis GCRA 的限流器, 多个副本共享配额
+// 每个副本需要 Register 相同的 r 与 b
+type RedisRateLimiter struct {
+	cfg    *RedisRateLimiterConf
+	client redis.UniversalClient
+
+	mutex  sync.RWMutex
+	limits map[string]rateLimit
+}
+
+// NewRedisRateLimiter client 由调用方管理
+func NewRedisRateLimiter(client redis.UniversalClient, cfg ...*RedisRateLimiterConf) *RedisRateLimiter {
+	conf := &RedisRateLimiterConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &RedisRateLimiter{
+		cfg:    conf,
+		client: client,
+		limits: make(map[string]rateLimit),
+	}
+}
+
+func (lim *RedisRateLimiter) Register(key string, r, b int) {
+	lim.mutex.Lock()
+	defer lim.mutex.Unlock()
+	lim.limits[key] = rateLimit{r: r, b: b}
+}
+
+func (lim *RedisRateLimiter) limit(key string) (rateLimit, bool) {
+	lim.mutex.RLock()
+	defer lim.mutex.RUnlock()
+	l, ok := lim.limits[key]
+	return l, ok
+}
+
+func (lim *RedisRateLimiter) take(ctx context.Context, key string, l rateLimit) (RateLimitResult, error) {
+	if l.r <= 0 {
+		return RateLimitResult{Limit: l.b}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, lim.cfg.Timeout)
+	defer cancel()
+	v, err := redisRateGCRAScript.Run(ctx, lim.client, []string{lim.cfg.Prefix + key}, l.b, l.r).Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(v) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected gcra result %v", v)
+	}
+	allowed, _ := v[0].(int64)
+	remaining, _ := v[1].(int64)
+	retryAfter, err := parseSeconds(v[2])
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	resetAfter, err := parseSeconds(v[3])
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Limit:      l.b,
+		Allowed:    allowed == 1,
+		Remaining:  int(remaining),
+		RetryAfter: retryAfter,
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+// Take 按 r 与 b 对 key 限流一次, key 不需要注册, 过期由 redis 回收
+func (lim *RedisRateLimiter) Take(ctx context.Context, key string, r, b int) (RateLimitResult, error) {
+	return lim.take(ctx, key, rateLimit{r: r, b: b})
+}
+
+func parseSeconds(v interface{}) (time.Duration, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected seconds %v", v)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// FailClosed redis 出错时是否拒绝请求, MidClientLimiter 据此处理 Take 的错误
+func (lim *RedisRateLimiter) FailClosed() bool {
+	return lim.cfg.FailClosed
+}
+
+// Allow 是否允许通过, redis 出错时按 FailClosed 处理
+func (lim *RedisRateLimiter) Allow(key string) bool {
+	l, ok := lim.limit(key)
+	if !ok {
+		return true
+	}
+	res, err := lim.take(context.Background(), key, l)
+	if err != nil {
+		log.Printf("WARNING: redis rate limiter %s %s\n", key, err.Error())
+		return !lim.cfg.FailClosed
+	}
+	return res.Allowed
+}
+
+// Wait 等待直到有请求可以通过, 按 RetryAfter 重试, 等待会超过 ctx deadline 时立即返回错误
+func (lim *RedisRateLimiter) Wait(ctx context.Context, key string) error {
+	l, ok := lim.limit(key)
+	if !ok {
+		return nil
+	}
+	if l.r <= 0 || l.b <= 0 {
+		return fmt.Errorf("rate: Wait(n=1) exceeds limiter's burst %d", l.b)
+	}
+	for {
+		res, err := lim.take(ctx, key, l)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if lim.cfg.FailClosed {
+				return err
+			}
+			log.Printf("WARNING: redis rate limiter %s %s\n", key, err.Error())
+			return nil
+		}
+		if res.Allowed {
+			return nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < res.RetryAfter {
+			return fmt.Errorf("rate: Wait(n=1) would exceed context deadline")
+		}
+		timer := time.NewTimer(res.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
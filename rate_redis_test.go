@@ -0,0 +1,96 @@
+package bkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisRateLimiter(t *testing.T, mr *miniredis.Miniredis) *RedisRateLimiter {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	// -race 下单次请求可能超过默认超时, 放宽超时并拒绝, 避免出错时放行导致计数不准
+	return NewRedisRateLimiter(client, &RedisRateLimiterConf{Timeout: 2 * time.Second, FailClosed: true})
+}
+
+func TestRedisRateLimiterShared(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicas := []*RedisRateLimiter{newTestRedisRateLimiter(t, mr), newTestRedisRateLimiter(t, mr)}
+	for _, lim := range replicas {
+		lim.Register("api", 1, 5)
+	}
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if replicas[i%2].Allow("api") {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("expect 5 allowed across replicas, got %d", allowed)
+	}
+	if !replicas[0].Allow("unregistered") {
+		t.Fatal("unregistered key should not be limited")
+	}
+
+	res, err := replicas[0].take(context.Background(), "api", rateLimit{r: 1, b: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Second {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestRedisRateLimiterWait(t *testing.T) {
+	lim := newTestRedisRateLimiter(t, miniredis.RunT(t))
+	lim.Register("api", 20, 1)
+	if !lim.Allow("api") {
+		t.Fatal("first request should be allowed")
+	}
+	start := time.Now()
+	if err := lim.Wait(context.Background(), "api"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond || d > time.Second {
+		t.Fatalf("unexpected wait %s", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := lim.Wait(ctx, "api"); err == nil {
+		t.Fatal("expect deadline error")
+	}
+
+	lim.Register("closed", 1, 0)
+	if lim.Allow("closed") {
+		t.Fatal("burst 0 should reject")
+	}
+	if err := lim.Wait(context.Background(), "closed"); err == nil {
+		t.Fatal("expect burst error")
+	}
+}
+
+func TestMidAPILimiterBackend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lim := newTestRedisRateLimiter(t, miniredis.RunT(t))
+	engine := gin.New()
+	engine.GET("/ping", Gin.MidAPILimiter("/ping", "get", 1, 1, false, lim), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("unexpected codes %v", codes)
+	}
+}
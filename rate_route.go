@@ -0,0 +1,186 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RouteLimit 路由限流配置
+type RouteLimit struct {
+	Route  string `json:"route" yaml:"route" toml:"route"`    // 路由模板, 与 gin 注册的路径一致, 例如 /user/:id
+	Method string `json:"method" yaml:"method" toml:"method"` // 为空或 * 匹配所有方法
+	Rate   int    `json:"rate" yaml:"rate" toml:"rate"`       // 每秒请求数
+	Burst  int    `json:"burst" yaml:"burst" toml:"burst"`    // 桶的容量, 默认 Rate
+}
+
+func (l *RouteLimit) Validate() error {
+	if l.Route == "" {
+		return fmt.Errorf("route required")
+	}
+	if l.Rate <= 0 {
+		return fmt.Errorf("route %s rate required", l.Route)
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Rate
+	}
+	l.Method = strings.ToUpper(l.Method)
+	if l.Method == "" {
+		l.Method = "*"
+	}
+	return nil
+}
+
+// Key 限流器的 key, 与 MidAPILimiter 一致
+func (l RouteLimit) Key() string {
+	return fmt.Sprintf("%s_%s", l.Route, l.Method)
+}
+
+// RouteLimitConfig 配置文件中的限流表, 服务配置文件中增加 rate_limits 即可被 RouteLimiter 读取
+//
+//	rate_limits:
+//	  - route: /user/:id
+//	    method: GET
+//	    rate: 100
+//	    burst: 200
+type RouteLimitConfig struct {
+	RateLimits []RouteLimit `json:"rate_limits" yaml:"rate_limits" toml:"rate_limits"`
+}
+
+// RouteLimiter 按路由模板与方法限流, 限流表可以从配置文件热加载
+type RouteLimiter struct {
+	limiter RateLimiter
+
+	mutex  sync.RWMutex
+	limits map[string]RouteLimit
+}
+
+// NewRouteLimiter limiter 默认进程内 LimiterUtil, 多副本共享配额使用 RedisRateLimiter
+func NewRouteLimiter(limiter ...RateLimiter) *RouteLimiter {
+	var lim RateLimiter = NewLimiterUtil()
+	if len(limiter) > 0 && limiter[0] != nil {
+		lim = limiter[0]
+	}
+	return &RouteLimiter{
+		limiter: lim,
+		limits:  make(map[string]RouteLimit),
+	}
+}
+
+// Load 替换整个限流表, 任一配置无效时不生效, 表中移除的路由不再限流
+func (l *RouteLimiter) Load(limits []RouteLimit) error {
+	m := make(map[string]RouteLimit, len(limits))
+	for _, v := range limits {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+		if _, ok := m[v.Key()]; ok {
+			return fmt.Errorf("route %s %s duplicated", v.Route, v.Method)
+		}
+		m[v.Key()] = v
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for key, v := range m {
+		l.limiter.Register(key, v.Rate, v.Burst)
+	}
+	l.limits = m
+	return nil
+}
+
+// LoadConfig 通过 ReadConfig 读取配置文件中的 rate_limits
+func (l *RouteLimiter) LoadConfig(filename string) error {
+	cfg := &RouteLimitConfig{}
+	if err := ReadConfig(filename, cfg); err != nil {
+		return err
+	}
+	return l.Load(cfg.RateLimits)
+}
+
+// WatchConfig 定时检查配置文件, 修改后重新加载, 加载失败保留原配置, 阻塞直到 ctx 结束
+func (l *RouteLimiter) WatchConfig(ctx context.Context, filename string, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(filename); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(filename)
+		if err != nil {
+			log.Printf("WARNING: route limiter stat %s %s\n", filename, err.Error())
+			continue
+		}
+		if fi.ModTime().Equal(modTime) && fi.Size() == size {
+			continue
+		}
+		modTime, size = fi.ModTime(), fi.Size()
+		if err := l.LoadConfig(filename); err != nil {
+			log.Printf("WARNING: route limiter reload %s %s\n", filename, err.Error())
+			continue
+		}
+		log.Printf("route limiter reload %s\n", filename)
+	}
+}
+
+// Limits 当前限流表, 按路由与方法排序
+func (l *RouteLimiter) Limits() []RouteLimit {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	limits := make([]RouteLimit, 0, len(l.limits))
+	for _, v := range l.limits {
+		limits = append(limits, v)
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		if limits[i].Route != limits[j].Route {
+			return limits[i].Route < limits[j].Route
+		}
+		return limits[i].Method < limits[j].Method
+	})
+	return limits
+}
+
+// match 先精确匹配方法, 再匹配 *
+func (l *RouteLimiter) match(route, method string) (string, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for _, m := range []string{method, "*"} {
+		key := fmt.Sprintf("%s_%s", route, m)
+		if _, ok := l.limits[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Allow 是否允许通过, 未配置的路由不限流
+func (l *RouteLimiter) Allow(route, method string) bool {
+	key, ok := l.match(route, method)
+	if !ok {
+		return true
+	}
+	return l.limiter.Allow(key)
+}
+
+// Wait 等待直到有请求可以通过, 未配置的路由不限流
+func (l *RouteLimiter) Wait(ctx context.Context, route, method string) error {
+	key, ok := l.match(route, method)
+	if !ok {
+		return nil
+	}
+	return l.limiter.Wait(ctx, key)
+}
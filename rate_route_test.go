@@ -0,0 +1,113 @@
+package bkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRouteLimiterLoad(t *testing.T) {
+	l := NewRouteLimiter()
+	if err := l.Load([]RouteLimit{{Route: "/a", Rate: 1}, {Route: "/a", Method: "*", Rate: 2}}); err == nil {
+		t.Fatal("expect duplicated error")
+	}
+	if err := l.Load([]RouteLimit{{Route: "/a"}}); err == nil {
+		t.Fatal("expect rate required error")
+	}
+	if err := l.Load([]RouteLimit{{Route: "/a", Method: "post", Rate: 1}, {Route: "/a", Rate: 1, Burst: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	limits := l.Limits()
+	if len(limits) != 2 || limits[0].Method != "*" || limits[1].Method != "POST" || limits[1].Burst != 1 {
+		t.Fatalf("unexpected limits %+v", limits)
+	}
+
+	// POST 精确匹配, GET 匹配 *
+	if !l.Allow("/a", http.MethodPost) || l.Allow("/a", http.MethodPost) {
+		t.Fatal("POST limit not applied")
+	}
+	if !l.Allow("/a", http.MethodGet) || !l.Allow("/a", http.MethodGet) || l.Allow("/a", http.MethodGet) {
+		t.Fatal("wildcard limit not applied")
+	}
+	if !l.Allow("/b", http.MethodGet) {
+		t.Fatal("unconfigured route limited")
+	}
+
+	// 移除后不再限流
+	_ = l.Load(nil)
+	if !l.Allow("/a", http.MethodPost) {
+		t.Fatal("removed route limited")
+	}
+}
+
+func TestRouteLimiterWatchConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("name: svc\nrate_limits:\n  - route: /user/:id\n    method: get\n    rate: 1\n")
+	l := NewRouteLimiter()
+	if err := l.LoadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Gin.MidRouteLimiter(l, false))
+	engine.GET("/user/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	do := func(path string) int {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if do("/user/1") != http.StatusOK || do("/user/2") != http.StatusTooManyRequests {
+		t.Fatal("route pattern limit not applied")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.WatchConfig(ctx, filename, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	write("rate_limits:\n  - route: /user/:id\n    rate: 1000\n    burst: 1000\n")
+	waitFor(t, time.Second, func() bool {
+		limits := l.Limits()
+		return len(limits) == 1 && limits[0].Rate == 1000
+	}, "config not reloaded")
+	if do("/user/3") != http.StatusOK {
+		t.Fatal("reloaded limit not applied")
+	}
+
+	// 无效配置保留原限流表
+	write("rate_limits:\n  - route: /user/:id\n    rate: 0\n")
+	time.Sleep(50 * time.Millisecond)
+	if limits := l.Limits(); len(limits) != 1 || limits[0].Rate != 1000 {
+		t.Fatalf("invalid config applied %+v", limits)
+	}
+}
+
+func TestMidAPILimiterFullPath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/order/:id", Gin.MidAPILimiter("/order/:id", "get", 1, 1, false, NewLimiterUtil()), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	codes := make([]int, 0, 2)
+	for _, path := range []string{"/order/1", "/order/2"} {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("unexpected codes %v", codes)
+	}
+}
@@ -0,0 +1,531 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	JobRunRunning  = "running"
+	JobRunSuccess  = "success"
+	JobRunRetrying = "retrying"
+	JobRunFailed   = "failed"
+)
+
+// JobDef 任务定义, 保存在存储中
+type JobDef struct {
+	ID         string        `json:"id" bson:"_id"`
+	Spec       string        `json:"spec" bson:"spec"`               // cron 表达式, 支持秒, 与 TaskServer.AddCronFunc 一致
+	MaxRetries int           `json:"max_retries" bson:"max_retries"` // 失败重试次数, 0 使用 SchedulerConf.MaxRetries, 小于 0 不重试
+	Timeout    time.Duration `json:"timeout" bson:"timeout"`         // 单次执行超时, 0 不限制
+	UpdatedAt  time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+// JobRun 一次执行, JobID + ScheduledAt 唯一, 多个节点中只有抢占成功的执行
+type JobRun struct {
+	JobID       string    `json:"job_id" bson:"job_id"`
+	ScheduledAt time.Time `json:"scheduled_at" bson:"scheduled_at"`
+	Owner       string    `json:"owner" bson:"owner"`
+	Attempt     int       `json:"attempt" bson:"attempt"`
+	Status      string    `json:"status" bson:"status"`
+	Error       string    `json:"error" bson:"error"`
+	// LeaseExpire running 时为租约到期时间, 到期未完成其他节点可以接管; retrying 时为下次重试时间
+	LeaseExpire time.Time `json:"lease_expire" bson:"lease_expire"`
+	StartedAt   time.Time `json:"started_at" bson:"started_at"`
+	FinishedAt  time.Time `json:"finished_at" bson:"finished_at"`
+}
+
+// JobFunc 任务函数, 返回错误时按 MaxRetries 重试
+type JobFunc func(ctx context.Context) error
+
+// SchedulerStore 任务定义与执行记录的存储
+type SchedulerStore interface {
+	SaveJob(ctx context.Context, def JobDef) error
+	ListJobs(ctx context.Context) ([]JobDef, error)
+	// ClaimRun 抢占执行, 记录不存在时新建 Attempt=1
+	// 已存在且 running 租约过期或 retrying 到达重试时间时 Attempt+1, 成功返回 true 并回填 Attempt
+	ClaimRun(ctx context.Context, run *JobRun) (bool, error)
+	// ExtendRun 续租 LeaseExpire, Owner 与 Attempt 不匹配时返回 ErrLockLost
+	ExtendRun(ctx context.Context, run *JobRun) error
+	// FinishRun 记录执行结果, Owner 与 Attempt 不匹配时返回 ErrLockLost
+	FinishRun(ctx context.Context, run *JobRun) error
+	// DueRuns running 租约过期或 retrying 到达重试时间的记录
+	DueRuns(ctx context.Context, now time.Time) ([]JobRun, error)
+	// ListRuns 最近的执行记录, 按 ScheduledAt 倒序
+	ListRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error)
+}
+
+type SchedulerConf struct {
+	Owner           string        // 节点标识, 默认 NewRequestID
+	PollInterval    time.Duration // 检查到期任务的间隔, 默认 1s
+	Lease           time.Duration // 执行租约, 默认 1m, 执行期间每 Lease/3 续租
+	MaxRetries      int           // 默认重试次数, 默认 3
+	RetryBackoff    time.Duration // 首次重试间隔, 默认 10s, 之后翻倍
+	MaxRetryBackoff time.Duration // 最大重试间隔, 默认 10m
+}
+
+func (c *SchedulerConf) Validate() error {
+	if c.Owner == "" {
+		c.Owner = NewRequestID().Hex()
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.Lease <= 0 {
+		c.Lease = time.Minute
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 10 * time.Second
+	}
+	if c.MaxRetryBackoff < c.RetryBackoff {
+		c.MaxRetryBackoff = 10 * time.Minute
+		if c.MaxRetryBackoff < c.RetryBackoff {
+			c.MaxRetryBackoff = c.RetryBackoff
+		}
+	}
+	return nil
+}
+
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// alignedDelaySchedule @every 按 Unix 时间对齐, 各节点计算出相同的执行时间
+type alignedDelaySchedule struct {
+	delay time.Duration
+}
+
+func (s alignedDelaySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(s.delay).Add(s.delay)
+}
+
+func parseJobSpec(spec string) (cron.Schedule, error) {
+	sched, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := sched.(cron.ConstantDelaySchedule); ok {
+		return alignedDelaySchedule{delay: v.Delay}, nil
+	}
+	return sched, nil
+}
+
+type schedulerJob struct {
+	def   JobDef
+	sched cron.Schedule
+	fn    JobFunc
+	next  time.Time
+}
+
+// Scheduler 持久化的定时任务, 多个节点运行相同的任务, 每次执行只有一个节点抢占成功
+// 失败按退避重试, 节点宕机租约过期后由其他节点接管
+type Scheduler struct {
+	cfg   *SchedulerConf
+	store SchedulerStore
+
+	mutex sync.Mutex
+	jobs  map[string]*schedulerJob
+
+	cancel func()
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(store SchedulerStore, cfg ...*SchedulerConf) *Scheduler {
+	conf := &SchedulerConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = cfg[0]
+	}
+	_ = conf.Validate()
+	return &Scheduler{
+		cfg:   conf,
+		store: store,
+		jobs:  make(map[string]*schedulerJob),
+	}
+}
+
+// Owner 节点标识
+func (s *Scheduler) Owner() string {
+	return s.cfg.Owner
+}
+
+// AddJob 注册任务, Run 时保存定义到存储
+func (s *Scheduler) AddJob(def JobDef, fn JobFunc) error {
+	if def.ID == "" {
+		return fmt.Errorf("job id required")
+	}
+	if fn == nil {
+		return fmt.Errorf("func required")
+	}
+	sched, err := parseJobSpec(def.Spec)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.jobs[def.ID]; ok {
+		return fmt.Errorf("job %s exists", def.ID)
+	}
+	s.jobs[def.ID] = &schedulerJob{def: def, sched: sched, fn: fn}
+	return nil
+}
+
+// Runs 最近的执行记录
+func (s *Scheduler) Runs(ctx context.Context, jobID string, limit int) ([]JobRun, error) {
+	return s.store.ListRuns(ctx, jobID, limit)
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	now := time.Now()
+	s.mutex.Lock()
+	for _, job := range s.jobs {
+		job.def.UpdatedAt = now
+		if err := s.store.SaveJob(ctx, job.def); err != nil {
+			s.mutex.Unlock()
+			return fmt.Errorf("save job %s: %w", job.def.ID, err)
+		}
+		job.next = job.sched.Next(now)
+	}
+	s.mutex.Unlock()
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go s.loop(ctx)
+	return nil
+}
+
+// Shutdown 停止调度, 等待执行中的任务结束, 被取消的任务按失败重试
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	<-s.done
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.poll(ctx, time.Now())
+	}
+}
+
+func (s *Scheduler) poll(ctx context.Context, now time.Time) {
+	type due struct {
+		job *schedulerJob
+		at  time.Time
+	}
+	dues := make([]due, 0)
+	s.mutex.Lock()
+	for _, job := range s.jobs {
+		if !now.Before(job.next) {
+			// 错过的多次执行只补一次
+			dues = append(dues, due{job: job, at: job.next})
+			job.next = job.sched.Next(now)
+		}
+	}
+	s.mutex.Unlock()
+	sort.Slice(dues, func(i, j int) bool {
+		return dues[i].at.Before(dues[j].at)
+	})
+	for _, v := range dues {
+		s.claim(ctx, v.job, v.at)
+	}
+
+	runs, err := s.store.DueRuns(ctx, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("WARNING: scheduler due runs %s\n", err.Error())
+		}
+		return
+	}
+	for _, run := range runs {
+		s.mutex.Lock()
+		job, ok := s.jobs[run.JobID]
+		s.mutex.Unlock()
+		if ok {
+			s.claim(ctx, job, run.ScheduledAt)
+		}
+	}
+}
+
+func (s *Scheduler) claim(ctx context.Context, job *schedulerJob, at time.Time) {
+	now := time.Now()
+	run := &JobRun{
+		JobID:       job.def.ID,
+		ScheduledAt: at.Truncate(time.Second),
+		Owner:       s.cfg.Owner,
+		Status:      JobRunRunning,
+		LeaseExpire: now.Add(s.cfg.Lease),
+		StartedAt:   now,
+	}
+	ok, err := s.store.ClaimRun(ctx, run)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("WARNING: scheduler claim %s %s\n", job.def.ID, err.Error())
+		}
+		return
+	}
+	if !ok {
+		return
+	}
+	s.wg.Add(1)
+	go s.execute(ctx, job, run)
+}
+
+func (s *Scheduler) execute(ctx context.Context, job *schedulerJob, run *JobRun) {
+	defer s.wg.Done()
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if job.def.Timeout > 0 {
+		var cancel func()
+		runCtx, cancel = context.WithTimeout(runCtx, job.def.Timeout)
+		defer cancel()
+	}
+
+	// 执行期间续租, 租约丢失或最后一次续租成功的租约到期时取消任务, 此时其他节点可以接管
+	heartbeat := make(chan struct{})
+	defer close(heartbeat)
+	go func() {
+		ticker := time.NewTicker(s.cfg.Lease / 3)
+		defer ticker.Stop()
+		expire := run.LeaseExpire
+		deadline := time.NewTimer(time.Until(expire))
+		defer deadline.Stop()
+		for {
+			select {
+			case <-heartbeat:
+				return
+			case <-deadline.C:
+				log.Printf("WARNING: scheduler job %s attempt %d lease expired\n", run.JobID, run.Attempt)
+				stop()
+				return
+			case <-ticker.C:
+			}
+			lease := *run
+			lease.LeaseExpire = time.Now().Add(s.cfg.Lease)
+			extendCtx, extendCancel := context.WithDeadline(runCtx, expire)
+			err := s.store.ExtendRun(extendCtx, &lease)
+			extendCancel()
+			switch {
+			case err == nil:
+				expire = lease.LeaseExpire
+				if !deadline.Stop() {
+					select {
+					case <-deadline.C:
+					default:
+					}
+				}
+				deadline.Reset(time.Until(expire))
+			case err == ErrLockLost:
+				stop()
+				return
+			case runCtx.Err() == nil:
+				log.Printf("WARNING: scheduler extend %s %s\n", run.JobID, err.Error())
+			}
+		}
+	}()
+
+	err := callJobFunc(runCtx, job.fn)
+
+	finish := *run
+	finish.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		finish.Status = JobRunSuccess
+	case finish.Attempt <= s.maxRetries(job.def):
+		finish.Status = JobRunRetrying
+		finish.Error = err.Error()
+		finish.LeaseExpire = finish.FinishedAt.Add(s.backoff(finish.Attempt))
+	default:
+		finish.Status = JobRunFailed
+		finish.Error = err.Error()
+	}
+	if err != nil {
+		log.Printf("WARNING: scheduler job %s attempt %d %s\n", job.def.ID, finish.Attempt, err.Error())
+	}
+	storeCtx, storeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer storeCancel()
+	if err := s.store.FinishRun(storeCtx, &finish); err != nil {
+		log.Printf("WARNING: scheduler finish %s %s\n", job.def.ID, err.Error())
+	}
+}
+
+func (s *Scheduler) maxRetries(def JobDef) int {
+	if def.MaxRetries == 0 {
+		return s.cfg.MaxRetries
+	}
+	return def.MaxRetries
+}
+
+// backoff 第 attempt 次失败后的重试间隔
+func (s *Scheduler) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryBackoff
+	for i := 1; i < attempt && d < s.cfg.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > s.cfg.MaxRetryBackoff {
+		d = s.cfg.MaxRetryBackoff
+	}
+	return d
+}
+
+// callJobFunc panic 转为错误
+func callJobFunc(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("WARNING: scheduler job panic %v\n%s\n", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+var _ SchedulerStore = &MemorySchedulerStore{}
+
+// MemorySchedulerStore 内存存储, 用于测试或单进程
+type MemorySchedulerStore struct {
+	mutex sync.Mutex
+	jobs  map[string]JobDef
+	runs  map[string]*JobRun
+}
+
+func NewMemorySchedulerStore() *MemorySchedulerStore {
+	return &MemorySchedulerStore{
+		jobs: make(map[string]JobDef),
+		runs: make(map[string]*JobRun),
+	}
+}
+
+func memoryRunKey(jobID string, at time.Time) string {
+	return fmt.Sprintf("%s/%d", jobID, at.Unix())
+}
+
+func (m *MemorySchedulerStore) SaveJob(ctx context.Context, def JobDef) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.jobs[def.ID] = def
+	return nil
+}
+
+func (m *MemorySchedulerStore) ListJobs(ctx context.Context) ([]JobDef, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defs := make([]JobDef, 0, len(m.jobs))
+	for _, v := range m.jobs {
+		defs = append(defs, v)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].ID < defs[j].ID
+	})
+	return defs, nil
+}
+
+func (m *MemorySchedulerStore) ClaimRun(ctx context.Context, run *JobRun) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := memoryRunKey(run.JobID, run.ScheduledAt)
+	v, ok := m.runs[key]
+	if !ok {
+		run.Attempt, run.Status = 1, JobRunRunning
+		claimed := *run
+		m.runs[key] = &claimed
+		return true, nil
+	}
+	if (v.Status != JobRunRunning && v.Status != JobRunRetrying) || v.LeaseExpire.After(time.Now()) {
+		return false, nil
+	}
+	run.Attempt, run.Status = v.Attempt+1, JobRunRunning
+	claimed := *run
+	m.runs[key] = &claimed
+	return true, nil
+}
+
+func (m *MemorySchedulerStore) owned(run *JobRun) (*JobRun, error) {
+	v, ok := m.runs[memoryRunKey(run.JobID, run.ScheduledAt)]
+	if !ok || v.Owner != run.Owner || v.Attempt != run.Attempt {
+		return nil, ErrLockLost
+	}
+	return v, nil
+}
+
+func (m *MemorySchedulerStore) ExtendRun(ctx context.Context, run *JobRun) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, err := m.owned(run)
+	if err != nil {
+		return err
+	}
+	if v.Status != JobRunRunning {
+		return ErrLockLost
+	}
+	v.LeaseExpire = run.LeaseExpire
+	return nil
+}
+
+func (m *MemorySchedulerStore) FinishRun(ctx context.Context, run *JobRun) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, err := m.owned(run)
+	if err != nil {
+		return err
+	}
+	v.Status, v.Error, v.LeaseExpire, v.FinishedAt = run.Status, run.Error, run.LeaseExpire, run.FinishedAt
+	return nil
+}
+
+func (m *MemorySchedulerStore) DueRuns(ctx context.Context, now time.Time) ([]JobRun, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	runs := make([]JobRun, 0)
+	for _, v := range m.runs {
+		if (v.Status == JobRunRunning || v.Status == JobRunRetrying) && !v.LeaseExpire.After(now) {
+			runs = append(runs, *v)
+		}
+	}
+	return runs, nil
+}
+
+func (m *MemorySchedulerStore) ListRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	runs := make([]JobRun, 0)
+	for _, v := range m.runs {
+		if v.JobID == jobID {
+			runs = append(runs, *v)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ScheduledAt.After(runs[j].ScheduledAt)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
@@ -0,0 +1,217 @@
+package bkit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+var _ SchedulerStore = &MysqlSchedulerStore{}
+
+// MysqlSchedulerStore 基于 Mysql 的调度存储, 时间以毫秒时间戳保存
+type MysqlSchedulerStore struct {
+	db       *sql.DB
+	jobTable string
+	runTable string
+}
+
+// NewMysqlSchedulerStore 创建表 _scheduler_jobs 与 _scheduler_runs, db 由调用方管理
+func NewMysqlSchedulerStore(db *sql.DB) (*MysqlSchedulerStore, error) {
+	s := &MysqlSchedulerStore{
+		db:       db,
+		jobTable: "_scheduler_jobs",
+		runTable: "_scheduler_runs",
+	}
+	_, err := db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(255) PRIMARY KEY,
+			spec VARCHAR(255) NOT NULL,
+			max_retries INT NOT NULL,
+			timeout BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='调度任务定义表';`, s.jobTable))
+	if err != nil {
+		return nil, fmt.Errorf("create table %s: %w", s.jobTable, err)
+	}
+	// job_id + scheduled_at 唯一, 插入成功的节点获得执行权
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			job_id VARCHAR(255) NOT NULL,
+			scheduled_at BIGINT NOT NULL,
+			owner VARCHAR(255) NOT NULL,
+			attempt INT NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			error TEXT NOT NULL,
+			lease_expire BIGINT NOT NULL,
+			started_at BIGINT NOT NULL,
+			finished_at BIGINT NOT NULL,
+			PRIMARY KEY (job_id, scheduled_at),
+			KEY idx_status_lease (status, lease_expire)
+		)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='调度任务执行记录表';`, s.runTable))
+	if err != nil {
+		return nil, fmt.Errorf("create table %s: %w", s.runTable, err)
+	}
+	return s, nil
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func (s *MysqlSchedulerStore) SaveJob(ctx context.Context, def JobDef) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+	INSERT INTO %s (id, spec, max_retries, timeout, updated_at) VALUES (?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE spec = VALUES(spec), max_retries = VALUES(max_retries), timeout = VALUES(timeout), updated_at = VALUES(updated_at)`, s.jobTable),
+		def.ID, def.Spec, def.MaxRetries, int64(def.Timeout), unixMilli(def.UpdatedAt))
+	return err
+}
+
+func (s *MysqlSchedulerStore) ListJobs(ctx context.Context) ([]JobDef, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT id, spec, max_retries, timeout, updated_at FROM %s ORDER BY id", s.jobTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	defs := make([]JobDef, 0)
+	for rows.Next() {
+		var (
+			def       JobDef
+			timeout   int64
+			updatedAt int64
+		)
+		if err := rows.Scan(&def.ID, &def.Spec, &def.MaxRetries, &timeout, &updatedAt); err != nil {
+			return nil, err
+		}
+		def.Timeout = time.Duration(timeout)
+		def.UpdatedAt = fromUnixMilli(updatedAt)
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// ClaimRun 先插入, 主键冲突时更新可接管的记录, 行锁保证只有一个节点更新成功
+func (s *MysqlSchedulerStore) ClaimRun(ctx context.Context, run *JobRun) (bool, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+	INSERT IGNORE INTO %s (job_id, scheduled_at, owner, attempt, status, error, lease_expire, started_at, finished_at)
+	VALUES (?, ?, ?, 1, ?, '', ?, ?, 0)`, s.runTable),
+		run.JobID, unixMilli(run.ScheduledAt), run.Owner, JobRunRunning, unixMilli(run.LeaseExpire), unixMilli(run.StartedAt))
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n > 0 {
+		run.Attempt = 1
+		run.Status = JobRunRunning
+		return true, nil
+	}
+
+	res, err = s.db.ExecContext(ctx, fmt.Sprintf(`
+	UPDATE %s SET owner = ?, attempt = attempt + 1, status = ?, error = '', lease_expire = ?, started_at = ?, finished_at = 0
+	WHERE job_id = ? AND scheduled_at = ? AND status IN (?, ?) AND lease_expire <= ?`, s.runTable),
+		run.Owner, JobRunRunning, unixMilli(run.LeaseExpire), unixMilli(run.StartedAt),
+		run.JobID, unixMilli(run.ScheduledAt), JobRunRunning, JobRunRetrying, time.Now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+	SELECT attempt FROM %s WHERE job_id = ? AND scheduled_at = ? AND owner = ?`, s.runTable),
+		run.JobID, unixMilli(run.ScheduledAt), run.Owner).Scan(&run.Attempt); err != nil {
+		return false, err
+	}
+	run.Status = JobRunRunning
+	return true, nil
+}
+
+func (s *MysqlSchedulerStore) ExtendRun(ctx context.Context, run *JobRun) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+	UPDATE %s SET lease_expire = ? WHERE job_id = ? AND scheduled_at = ? AND owner = ? AND attempt = ? AND status = ?`, s.runTable),
+		unixMilli(run.LeaseExpire), run.JobID, unixMilli(run.ScheduledAt), run.Owner, run.Attempt, JobRunRunning)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (s *MysqlSchedulerStore) FinishRun(ctx context.Context, run *JobRun) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+	UPDATE %s SET status = ?, error = ?, lease_expire = ?, finished_at = ?
+	WHERE job_id = ? AND scheduled_at = ? AND owner = ? AND attempt = ?`, s.runTable),
+		run.Status, run.Error, unixMilli(run.LeaseExpire), unixMilli(run.FinishedAt),
+		run.JobID, unixMilli(run.ScheduledAt), run.Owner, run.Attempt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (s *MysqlSchedulerStore) DueRuns(ctx context.Context, now time.Time) ([]JobRun, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+	SELECT job_id, scheduled_at, owner, attempt, status, error, lease_expire, started_at, finished_at
+	FROM %s WHERE status IN (?, ?) AND lease_expire <= ?`, s.runTable), JobRunRunning, JobRunRetrying, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	return scanJobRuns(rows)
+}
+
+func (s *MysqlSchedulerStore) ListRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error) {
+	query := fmt.Sprintf(`
+	SELECT job_id, scheduled_at, owner, attempt, status, error, lease_expire, started_at, finished_at
+	FROM %s WHERE job_id = ? ORDER BY scheduled_at DESC`, s.runTable)
+	args := []interface{}{jobID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobRuns(rows)
+}
+
+func scanJobRuns(rows *sql.Rows) ([]JobRun, error) {
+	defer rows.Close()
+	runs := make([]JobRun, 0)
+	for rows.Next() {
+		var (
+			run                                         JobRun
+			scheduledAt, leaseExpire, started, finished int64
+		)
+		if err := rows.Scan(&run.JobID, &scheduledAt, &run.Owner, &run.Attempt, &run.Status, &run.Error,
+			&leaseExpire, &started, &finished); err != nil {
+			return nil, err
+		}
+		run.ScheduledAt = fromUnixMilli(scheduledAt)
+		run.LeaseExpire = fromUnixMilli(leaseExpire)
+		run.StartedAt = fromUnixMilli(started)
+		run.FinishedAt = fromUnixMilli(finished)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,178 @@
+package bkit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerClaimOnce(t *testing.T) {
+	store := NewMemorySchedulerStore()
+	var (
+		mutex sync.Mutex
+		count = make(map[int64]int)
+	)
+	nodes := make([]*Scheduler, 0, 3)
+	for i := 0; i < 3; i++ {
+		s := NewScheduler(store, &SchedulerConf{Owner: fmt.Sprintf("node-%d", i), PollInterval: 20 * time.Millisecond})
+		if err := s.AddJob(JobDef{ID: "every", Spec: "@every 1s"}, func(ctx context.Context) error {
+			mutex.Lock()
+			count[time.Now().Unix()]++
+			mutex.Unlock()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, s)
+	}
+	time.Sleep(2500 * time.Millisecond)
+	for _, s := range nodes {
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := store.ListRuns(context.Background(), "every", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) < 2 {
+		t.Fatalf("expect at least 2 runs, got %d", len(runs))
+	}
+	for _, run := range runs {
+		if run.Status != JobRunSuccess || run.Attempt != 1 {
+			t.Fatalf("unexpected run %+v", run)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for sec, n := range count {
+		if n != 1 {
+			t.Fatalf("second %d executed %d times", sec, n)
+		}
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	store := NewMemorySchedulerStore()
+	s := NewScheduler(store, &SchedulerConf{
+		PollInterval: 20 * time.Millisecond,
+		RetryBackoff: 50 * time.Millisecond,
+	})
+	var calls int32
+	_ = s.AddJob(JobDef{ID: "flaky", Spec: "@every 1s", MaxRetries: 2}, func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return fmt.Errorf("flaky")
+		}
+		return nil
+	})
+	_ = s.AddJob(JobDef{ID: "panic", Spec: "@every 1s", MaxRetries: -1}, func(ctx context.Context) error {
+		panic("boom")
+	})
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	_ = s.Shutdown(context.Background())
+
+	runs, _ := store.ListRuns(context.Background(), "flaky", 0)
+	if len(runs) == 0 {
+		t.Fatal("no runs")
+	}
+	last := runs[len(runs)-1]
+	if last.Status != JobRunSuccess || last.Attempt != 3 {
+		t.Fatalf("unexpected run %+v", last)
+	}
+
+	runs, _ = store.ListRuns(context.Background(), "panic", 0)
+	if len(runs) == 0 || runs[0].Status != JobRunFailed || runs[0].Attempt != 1 || runs[0].Error == "" {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+}
+
+func TestSchedulerTakeOver(t *testing.T) {
+	store := NewMemorySchedulerStore()
+	at := time.Now().Add(-time.Minute).Truncate(time.Second)
+	dead := &JobRun{JobID: "job", ScheduledAt: at, Owner: "dead", LeaseExpire: time.Now().Add(-time.Second)}
+	if ok, _ := store.ClaimRun(context.Background(), dead); !ok {
+		t.Fatal("claim failed")
+	}
+
+	s := NewScheduler(store, &SchedulerConf{Owner: "alive", PollInterval: 20 * time.Millisecond})
+	done := make(chan struct{}, 1)
+	_ = s.AddJob(JobDef{ID: "job", Spec: "0 0 0 1 1 *"}, func(ctx context.Context) error {
+		done <- struct{}{}
+		return nil
+	})
+	_ = s.Run(context.Background())
+	defer s.Shutdown(context.Background())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expired run not taken over")
+	}
+
+	if err := store.FinishRun(context.Background(), &JobRun{JobID: "job", ScheduledAt: at, Owner: "dead", Attempt: 1}); err != ErrLockLost {
+		t.Fatalf("expect ErrLockLost, got %v", err)
+	}
+	waitFor(t, time.Second, func() bool {
+		runs, _ := store.ListRuns(context.Background(), "job", 1)
+		return len(runs) == 1 && runs[0].Owner == "alive" && runs[0].Attempt == 2 && runs[0].Status == JobRunSuccess
+	}, "run not finished by new owner")
+}
+
+// failExtendStore 续租一直返回 IO 错误
+type failExtendStore struct {
+	*MemorySchedulerStore
+}
+
+func (s *failExtendStore) ExtendRun(ctx context.Context, run *JobRun) error {
+	return fmt.Errorf("store unavailable")
+}
+
+func TestSchedulerLeaseExpire(t *testing.T) {
+	lease := 300 * time.Millisecond
+	s := NewScheduler(&failExtendStore{NewMemorySchedulerStore()}, &SchedulerConf{
+		PollInterval: 20 * time.Millisecond,
+		Lease:        lease,
+		MaxRetries:   -1,
+	})
+	elapsed := make(chan time.Duration, 1)
+	_ = s.AddJob(JobDef{ID: "job", Spec: "@every 1s"}, func(ctx context.Context) error {
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+		case <-time.After(3 * time.Second):
+		}
+		select {
+		case elapsed <- time.Since(start):
+		default:
+		}
+		return ctx.Err()
+	})
+	_ = s.Run(context.Background())
+	defer s.Shutdown(context.Background())
+	select {
+	case d := <-elapsed:
+		if d > lease+200*time.Millisecond {
+			t.Fatalf("job should cancel at lease deadline, ran %s", d)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not finished")
+	}
+}
+
+func TestSchedulerBackoff(t *testing.T) {
+	s := NewScheduler(NewMemorySchedulerStore(), &SchedulerConf{RetryBackoff: time.Second, MaxRetryBackoff: 5 * time.Second})
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := s.backoff(attempt); got != want {
+			t.Fatalf("attempt %d expect %s, got %s", attempt, want, got)
+		}
+	}
+}
@@ -11,8 +11,6 @@ import (
 	"sync"
 	"syscall"
 	"time"
-
-	"github.com/robfig/cron/v3"
 )
 
 // RunServerAndListenExitSignal 运行服务，并监听退出信号
@@ -136,65 +134,53 @@ type TaskServer struct {
 
 	wg *sync.WaitGroup
 
-	afters []timeAfterFunc
-	c      *cron.Cron
+	mutex   sync.Mutex
+	jobs    map[string]*taskJob
+	order   []string
+	seq     int
+	stopped bool
+	onPanic TaskPanicHandler
+
+	elector *LeaderElector
 }
 
 func NewTaskServer() *TaskServer {
 	s := &TaskServer{
-		wg:     &sync.WaitGroup{},
-		afters: make([]timeAfterFunc, 0),
+		wg:   &sync.WaitGroup{},
+		jobs: make(map[string]*taskJob),
 	}
 	return s
 }
 
-type timeAfterFunc struct {
-	d      time.Duration
-	isOnce bool
-	fn     func(ctx context.Context)
-}
-
 func (s *TaskServer) Run(ctx context.Context) error {
+	s.mutex.Lock()
 	s.ctx, s.cancel = context.WithCancel(ctx)
-
-	for _, v := range s.afters {
-		// register and run time.AfterFunc
-		exec := func(ctx context.Context, wg *sync.WaitGroup, fn timeAfterFunc) {
-			for {
-				time.Sleep(fn.d)
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					func() {
-						// WaitGroup is reused before previous Wait has returned
-						wg.Add(1)
-						fn.fn(ctx)
-						wg.Done()
-					}()
-					if fn.isOnce {
-						return
-					}
-				}
-			}
-		}
-		go exec(s.ctx, s.wg, v)
+	start := time.Now()
+	for _, id := range s.order {
+		go s.loop(s.ctx, s.jobs[id], start)
 	}
+	s.mutex.Unlock()
 
-	if s.c != nil {
-		s.c.Start()
+	if s.elector != nil {
+		return s.elector.Run(s.ctx)
 	}
-
 	return nil
 }
 
 func (s *TaskServer) Shutdown(ctx context.Context) error {
-	s.cancel()
-	if s.c != nil {
-		<-s.c.Stop().Done()
+	s.mutex.Lock()
+	if s.cancel != nil {
+		s.cancel()
 	}
+	s.stopped = true
+	s.mutex.Unlock()
 	// 等待所有任务结束
 	s.wg.Wait()
+	if s.elector != nil {
+		if err := s.elector.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 
 	log.Printf("task server shutdown\n")
 	return nil
@@ -203,58 +189,86 @@ func (s *TaskServer) Shutdown(ctx context.Context) error {
 // you can use AddTickerTimeAfterFunc replace this
 // Deprecated
 func (s *TaskServer) AddTimeAfterFunc(d time.Duration, fn func(ctx context.Context)) error {
-	if d <= 0 {
-		return fmt.Errorf("d required")
-	}
+	return s.AddTickerTimeAfterFunc(d, fn)
+}
+
+// AddOnceTimeAfterFunc after d, once exec
+func (s *TaskServer) AddOnceTimeAfterFunc(d time.Duration, fn func(ctx context.Context), cfg ...*TaskJobConf) error {
+	_, err := s.AddOnceJob(d, fn, cfg...)
+	return err
+}
+
+// AddTickerTimeAfterFunc ticker d, loop exec
+func (s *TaskServer) AddTickerTimeAfterFunc(d time.Duration, fn func(ctx context.Context), cfg ...*TaskJobConf) error {
+	_, err := s.AddTickerJob(d, fn, cfg...)
+	return err
+}
+
+func (s *TaskServer) AddCronFunc(spec string, fn func(), cfg ...*TaskJobConf) error {
 	if fn == nil {
 		return fmt.Errorf("func required")
 	}
-	s.afters = append(s.afters, timeAfterFunc{
-		d:  d,
-		fn: fn,
-	})
-	return nil
+	_, err := s.AddCronJob(spec, func(ctx context.Context) { fn() }, cfg...)
+	return err
 }
 
-// AddOnceTimeAfterFunc after d, once exec
-func (s *TaskServer) AddOnceTimeAfterFunc(d time.Duration, fn func(ctx context.Context)) error {
+// AddOnceJob after d, once exec, 返回任务 ID
+func (s *TaskServer) AddOnceJob(d time.Duration, fn func(ctx context.Context), cfg ...*TaskJobConf) (string, error) {
 	if d <= 0 {
-		return fmt.Errorf("d required")
+		return "", fmt.Errorf("d required")
 	}
 	if fn == nil {
-		return fmt.Errorf("func required")
+		return "", fmt.Errorf("func required")
 	}
-	s.afters = append(s.afters, timeAfterFunc{
-		d:      d,
-		isOnce: true,
-		fn:     fn,
-	})
-	return nil
+	return s.addJob(TaskKindOnce, d, "", nil, fn, cfg...)
 }
 
-// AddTickerTimeAfterFunc ticker d, loop exec
-func (s *TaskServer) AddTickerTimeAfterFunc(d time.Duration, fn func(ctx context.Context)) error {
+// AddTickerJob ticker d, loop exec, 返回任务 ID
+func (s *TaskServer) AddTickerJob(d time.Duration, fn func(ctx context.Context), cfg ...*TaskJobConf) (string, error) {
 	if d <= 0 {
-		return fmt.Errorf("d required")
+		return "", fmt.Errorf("d required")
 	}
 	if fn == nil {
-		return fmt.Errorf("func required")
+		return "", fmt.Errorf("func required")
 	}
-	s.afters = append(s.afters, timeAfterFunc{
-		d:      d,
-		isOnce: false,
-		fn:     fn,
-	})
-	return nil
+	return s.addJob(TaskKindTicker, d, "", nil, fn, cfg...)
 }
 
-func (s *TaskServer) AddCronFunc(spec string, fn func()) error {
-	if s.c == nil {
-		s.c = cron.New(cron.WithSeconds())
+// AddCronJob cron 任务, 支持秒, 返回任务 ID
+func (s *TaskServer) AddCronJob(spec string, fn func(ctx context.Context), cfg ...*TaskJobConf) (string, error) {
+	if fn == nil {
+		return "", fmt.Errorf("func required")
 	}
-	_, err := s.c.AddFunc(spec, fn)
+	sched, err := cronParser.Parse(spec)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return s.addJob(TaskKindCron, 0, spec, sched, fn, cfg...)
+}
+
+// SetLeaderElector 设置 leader 竞选, 随 TaskServer 启动竞选, Shutdown 时让出
+func (s *TaskServer) SetLeaderElector(e *LeaderElector) {
+	s.elector = e
+}
+
+// AddLeaderTickerTimeAfterFunc ticker d, 只在 leader 上执行
+func (s *TaskServer) AddLeaderTickerTimeAfterFunc(d time.Duration, fn func(ctx context.Context), cfg ...*TaskJobConf) error {
+	if s.elector == nil {
+		return fmt.Errorf("leader elector required")
+	}
+	if fn == nil {
+		return fmt.Errorf("func required")
+	}
+	return s.AddTickerTimeAfterFunc(d, s.elector.Func(fn), cfg...)
+}
+
+// AddLeaderCronFunc 只在 leader 上执行的 cron 任务
+func (s *TaskServer) AddLeaderCronFunc(spec string, fn func(), cfg ...*TaskJobConf) error {
+	if s.elector == nil {
+		return fmt.Errorf("leader elector required")
+	}
+	if fn == nil {
+		return fmt.Errorf("func required")
+	}
+	return s.AddCronFunc(spec, s.elector.CronFunc(fn), cfg...)
 }
@@ -0,0 +1,418 @@
+package bkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var ErrTaskJobNotFound = fmt.Errorf("task job not found")
+
+const (
+	TaskOverlapSkip       = "skip"       // 上一次未结束时跳过本次
+	TaskOverlapQueue      = "queue"      // 上一次未结束时排队, 串行执行
+	TaskOverlapConcurrent = "concurrent" // 允许并发执行
+
+	TaskKindTicker = "ticker"
+	TaskKindOnce   = "once"
+	TaskKindCron   = "cron"
+)
+
+// TaskJobConf 任务配置
+type TaskJobConf struct {
+	ID       string        // 任务 ID, 为空时自动分配 kind-序号
+	Timeout  time.Duration // 单次执行超时, 到期取消 ctx, 0 不限制
+	Overlap  string        // 重叠策略, ticker/once 默认 skip, cron 默认 concurrent
+	MaxQueue int           // Overlap=queue 时最多排队次数, 默认 1, 超出跳过
+}
+
+// TaskPanicHandler 任务 panic 的回调, 未设置时打印日志
+type TaskPanicHandler func(id string, r interface{}, stack []byte)
+
+// TaskJobStatus 任务状态
+type TaskJobStatus struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Spec      string    `json:"spec"`
+	Overlap   string    `json:"overlap"`
+	Timeout   string    `json:"timeout,omitempty"`
+	Paused    bool      `json:"paused"`
+	Running   int       `json:"running"`
+	Queued    int       `json:"queued"`
+	Runs      int64     `json:"runs"`
+	Skipped   int64     `json:"skipped"`
+	Panics    int64     `json:"panics"`
+	Timeouts  int64     `json:"timeouts"`
+	NextRun   time.Time `json:"next_run"`
+	LastStart time.Time `json:"last_start"`
+	LastEnd   time.Time `json:"last_end"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type taskJob struct {
+	id    string
+	kind  string
+	d     time.Duration
+	spec  string
+	sched cron.Schedule
+	fn    func(ctx context.Context)
+	cfg   TaskJobConf
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mutex  sync.Mutex
+	status TaskJobStatus
+	fired  bool // once 是否已触发
+}
+
+func newTaskJob(id, kind string, d time.Duration, spec string, sched cron.Schedule, fn func(ctx context.Context), cfg TaskJobConf) *taskJob {
+	if cfg.Overlap == "" {
+		cfg.Overlap = TaskOverlapSkip
+		if kind == TaskKindCron {
+			cfg.Overlap = TaskOverlapConcurrent
+		}
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = 1
+	}
+	if spec == "" {
+		spec = d.String()
+	}
+	job := &taskJob{
+		id:    id,
+		kind:  kind,
+		d:     d,
+		spec:  spec,
+		sched: sched,
+		fn:    fn,
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+	}
+	job.status = TaskJobStatus{ID: id, Kind: kind, Spec: spec, Overlap: cfg.Overlap}
+	if cfg.Timeout > 0 {
+		job.status.Timeout = cfg.Timeout.String()
+	}
+	return job
+}
+
+// next 下一次触发时间, once 触发后返回 false
+func (job *taskJob) next(start, now time.Time) (time.Time, bool) {
+	switch job.kind {
+	case TaskKindOnce:
+		if job.fired {
+			return time.Time{}, false
+		}
+		return start.Add(job.d), true
+	case TaskKindCron:
+		return job.sched.Next(now), true
+	}
+	return now.Add(job.d), true
+}
+
+func (job *taskJob) close() {
+	job.stopOnce.Do(func() {
+		close(job.stop)
+	})
+}
+
+func (job *taskJob) snapshot() TaskJobStatus {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.status
+}
+
+// loop 按计划触发, 暂停期间到期的执行跳过
+func (s *TaskServer) loop(ctx context.Context, job *taskJob, start time.Time) {
+	for {
+		job.mutex.Lock()
+		next, ok := job.next(start, time.Now())
+		job.status.NextRun = next
+		job.mutex.Unlock()
+		if !ok {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-job.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		job.mutex.Lock()
+		job.fired = true
+		paused := job.status.Paused
+		job.mutex.Unlock()
+		if !paused {
+			s.dispatch(ctx, job)
+		}
+	}
+}
+
+// dispatch 按重叠策略执行一次
+func (s *TaskServer) dispatch(ctx context.Context, job *taskJob) {
+	job.mutex.Lock()
+	if job.status.Running > 0 {
+		switch job.cfg.Overlap {
+		case TaskOverlapSkip:
+			job.status.Skipped++
+			job.mutex.Unlock()
+			return
+		case TaskOverlapQueue:
+			if job.status.Queued >= job.cfg.MaxQueue {
+				job.status.Skipped++
+			} else {
+				job.status.Queued++
+			}
+			job.mutex.Unlock()
+			return
+		}
+	}
+	job.status.Running++
+	job.mutex.Unlock()
+
+	// Shutdown 开始等待后不再 Add, 避免 WaitGroup is reused before previous Wait has returned
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		job.mutex.Lock()
+		job.status.Running--
+		job.mutex.Unlock()
+		return
+	}
+	s.wg.Add(1)
+	s.mutex.Unlock()
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.execute(ctx, job)
+			job.mutex.Lock()
+			if job.status.Queued == 0 || ctx.Err() != nil {
+				job.status.Queued = 0
+				job.status.Running--
+				job.mutex.Unlock()
+				return
+			}
+			job.status.Queued--
+			job.mutex.Unlock()
+		}
+	}()
+}
+
+func (s *TaskServer) execute(ctx context.Context, job *taskJob) {
+	start := time.Now()
+	job.mutex.Lock()
+	job.status.Runs++
+	job.status.LastStart = start
+	job.mutex.Unlock()
+
+	if job.cfg.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, job.cfg.Timeout)
+		defer cancel()
+	}
+	lastErr := ""
+	panicked := false
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panicked = true
+				lastErr = fmt.Sprintf("panic: %v", r)
+				s.panicked(job.id, r, debug.Stack())
+			}
+		}()
+		job.fn(ctx)
+	}()
+	timeout := job.cfg.Timeout > 0 && ctx.Err() == context.DeadlineExceeded
+	if timeout && lastErr == "" {
+		lastErr = fmt.Sprintf("timeout after %s", job.cfg.Timeout)
+	}
+
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.status.LastEnd = time.Now()
+	job.status.LastError = lastErr
+	if panicked {
+		job.status.Panics++
+	}
+	if timeout {
+		job.status.Timeouts++
+	}
+}
+
+func (s *TaskServer) panicked(id string, r interface{}, stack []byte) {
+	s.mutex.Lock()
+	fn := s.onPanic
+	s.mutex.Unlock()
+	if fn != nil {
+		fn(id, r, stack)
+		return
+	}
+	log.Printf("WARNING: task %s panic %v\n%s\n", id, r, stack)
+}
+
+// addJob 注册任务, Run 之后注册的任务立即开始调度
+func (s *TaskServer) addJob(kind string, d time.Duration, spec string, sched cron.Schedule, fn func(ctx context.Context), cfg ...*TaskJobConf) (string, error) {
+	conf := TaskJobConf{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = *cfg[0]
+	}
+	switch conf.Overlap {
+	case "", TaskOverlapSkip, TaskOverlapQueue, TaskOverlapConcurrent:
+	default:
+		return "", fmt.Errorf("invalid overlap %s", conf.Overlap)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if conf.ID == "" {
+		s.seq++
+		conf.ID = fmt.Sprintf("%s-%d", kind, s.seq)
+	}
+	if _, ok := s.jobs[conf.ID]; ok {
+		return "", fmt.Errorf("task job %s exists", conf.ID)
+	}
+	job := newTaskJob(conf.ID, kind, d, spec, sched, fn, conf)
+	s.jobs[job.id] = job
+	s.order = append(s.order, job.id)
+	if s.ctx != nil {
+		go s.loop(s.ctx, job, time.Now())
+	}
+	return job.id, nil
+}
+
+func (s *TaskServer) job(id string) (*taskJob, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrTaskJobNotFound
+	}
+	return job, nil
+}
+
+// SetPanicHandler 设置任务 panic 回调, panic 不会导致进程退出
+func (s *TaskServer) SetPanicHandler(fn TaskPanicHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onPanic = fn
+}
+
+// Pause 暂停任务, 执行中的不受影响, 暂停期间到期的执行跳过
+func (s *TaskServer) Pause(id string) error {
+	job, err := s.job(id)
+	if err != nil {
+		return err
+	}
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.status.Paused = true
+	return nil
+}
+
+func (s *TaskServer) Resume(id string) error {
+	job, err := s.job(id)
+	if err != nil {
+		return err
+	}
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.status.Paused = false
+	return nil
+}
+
+// Remove 移除任务, 执行中的不会被取消, Shutdown 时仍会等待
+func (s *TaskServer) Remove(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return ErrTaskJobNotFound
+	}
+	job.close()
+	delete(s.jobs, id)
+	for i, v := range s.order {
+		if v == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// TriggerNow 立即执行一次, 暂停时同样执行, 遵守重叠策略
+func (s *TaskServer) TriggerNow(id string) error {
+	job, err := s.job(id)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	ctx := s.ctx
+	s.mutex.Unlock()
+	if ctx == nil {
+		return fmt.Errorf("task server not running")
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.dispatch(ctx, job)
+	return nil
+}
+
+// Jobs 任务状态, 按注册顺序
+func (s *TaskServer) Jobs() []TaskJobStatus {
+	s.mutex.Lock()
+	jobs := make([]*taskJob, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, s.jobs[id])
+	}
+	s.mutex.Unlock()
+	status := make([]TaskJobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		status = append(status, job.snapshot())
+	}
+	return status
+}
+
+// Job 单个任务状态
+func (s *TaskServer) Job(id string) (TaskJobStatus, error) {
+	job, err := s.job(id)
+	if err != nil {
+		return TaskJobStatus{}, err
+	}
+	return job.snapshot(), nil
+}
+
+// StatusHandler 只读的任务状态接口, GET 返回全部任务, ?id= 返回单个任务
+func (s *TaskServer) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		var v interface{}
+		if id := r.URL.Query().Get("id"); id != "" {
+			status, err := s.Job(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			v = status
+		} else {
+			v = s.Jobs()
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(v)
+	})
+}
@@ -0,0 +1,148 @@
+package bkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTaskServerControl(t *testing.T) {
+	s := NewTaskServer()
+	var n int32
+	id, err := s.AddTickerJob(10*time.Millisecond, func(ctx context.Context) {
+		atomic.AddInt32(&n, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "ticker-1" {
+		t.Fatalf("unexpected id %s", id)
+	}
+	if _, err := s.AddTickerJob(time.Second, func(ctx context.Context) {}, &TaskJobConf{ID: id}); err == nil {
+		t.Fatal("expect duplicate id error")
+	}
+	manual, _ := s.AddCronJob("0 0 0 1 1 *", func(ctx context.Context) {
+		atomic.AddInt32(&n, 100)
+	}, &TaskJobConf{ID: "manual"})
+	if err := s.TriggerNow(manual); err == nil {
+		t.Fatal("expect not running error")
+	}
+
+	_ = s.Run(context.Background())
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&n) >= 2 }, "ticker not running")
+
+	_ = s.Pause(id)
+	time.Sleep(30 * time.Millisecond)
+	paused := atomic.LoadInt32(&n)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&n) != paused {
+		t.Fatal("paused job executed")
+	}
+	_ = s.Resume(id)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&n) > paused }, "resumed job not running")
+
+	before := atomic.LoadInt32(&n)
+	if err := s.TriggerNow(manual); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&n) >= before+100 }, "trigger not executed")
+
+	if err := s.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pause(id); err != ErrTaskJobNotFound {
+		t.Fatalf("expect ErrTaskJobNotFound, got %v", err)
+	}
+	if jobs := s.Jobs(); len(jobs) != 1 || jobs[0].ID != manual || jobs[0].Runs != 1 {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+	_ = s.Shutdown(context.Background())
+}
+
+func TestTaskServerOverlap(t *testing.T) {
+	s := NewTaskServer()
+	block := make(chan struct{})
+	fn := func(ctx context.Context) {
+		<-block
+	}
+	never := "0 0 0 1 1 *"
+	_, _ = s.AddCronJob(never, fn, &TaskJobConf{ID: "skip", Overlap: TaskOverlapSkip})
+	_, _ = s.AddCronJob(never, fn, &TaskJobConf{ID: "queue", Overlap: TaskOverlapQueue, MaxQueue: 1})
+	_, _ = s.AddCronJob(never, fn, &TaskJobConf{ID: "concurrent"})
+	_ = s.Run(context.Background())
+	for i := 0; i < 3; i++ {
+		for _, id := range []string{"skip", "queue", "concurrent"} {
+			_ = s.TriggerNow(id)
+		}
+	}
+
+	check := func(id string, running, queued int, skipped int64) {
+		st, _ := s.Job(id)
+		if st.Running != running || st.Queued != queued || st.Skipped != skipped {
+			t.Fatalf("%s unexpected status %+v", id, st)
+		}
+	}
+	check("skip", 1, 0, 2)
+	check("queue", 1, 1, 1)
+	check("concurrent", 3, 0, 0)
+	close(block)
+	waitFor(t, time.Second, func() bool {
+		st, _ := s.Job("queue")
+		return st.Runs == 2 && st.Running == 0
+	}, "queued run not executed")
+	_ = s.Shutdown(context.Background())
+}
+
+func TestTaskServerPanicAndTimeout(t *testing.T) {
+	s := NewTaskServer()
+	panics := make(chan string, 1)
+	s.SetPanicHandler(func(id string, r interface{}, stack []byte) {
+		panics <- id
+	})
+	_, _ = s.AddOnceJob(time.Millisecond, func(ctx context.Context) {
+		panic("boom")
+	}, &TaskJobConf{ID: "panic"})
+	_, _ = s.AddOnceJob(time.Millisecond, func(ctx context.Context) {
+		<-ctx.Done()
+	}, &TaskJobConf{ID: "slow", Timeout: 20 * time.Millisecond})
+	_ = s.Run(context.Background())
+
+	select {
+	case id := <-panics:
+		if id != "panic" {
+			t.Fatalf("unexpected id %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic not reported")
+	}
+	waitFor(t, time.Second, func() bool {
+		st, _ := s.Job("slow")
+		return st.Timeouts == 1 && st.Running == 0
+	}, "timeout not recorded")
+	_ = s.Shutdown(context.Background())
+
+	rec := httptest.NewRecorder()
+	s.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+	jobs := make([]TaskJobStatus, 0)
+	if err := json.Unmarshal(rec.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Panics != 1 || jobs[0].LastError != "panic: boom" {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	rec = httptest.NewRecorder()
+	s.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tasks", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	s.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks?id=none", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d", rec.Code)
+	}
+}